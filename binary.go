@@ -0,0 +1,531 @@
+package context
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/juju/errgo"
+)
+
+// The binary value format is self-describing. Each value starts with one of the
+// following tags. Structs are encoded like maps using the names of their JSON
+// fields, so that values decoded by older or newer code behave like JSON does,
+// i.e. unknown fields are ignored and missing fields keep their zero value.
+const (
+	binaryValueNil byte = iota
+	binaryValueFalse
+	binaryValueTrue
+	binaryValueInt
+	binaryValueUint
+	binaryValueFloat
+	binaryValueString
+	binaryValueList
+	binaryValueMap
+)
+
+// binaryUnsupportedError is returned when encoding values whose JSON
+// representation cannot be reproduced by the binary value format, e.g. values
+// implementing json.Marshaler. Such values are embedded as JSON instead.
+var binaryUnsupportedError = errgo.New("binary unsupported")
+
+var (
+	jsonMarshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType   = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshalerType     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType   = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	emptyInterfaceType    = reflect.TypeOf((*interface{})(nil)).Elem()
+	binaryStructFieldsMap sync.Map
+)
+
+// binaryField describes a struct field being encoded.
+type binaryField struct {
+	index int
+	name  string
+}
+
+// binaryFields returns the fields of the given struct type being encoded, like
+// encoding/json would do. Struct types having embedded fields are not supported.
+func binaryFields(t reflect.Type) ([]binaryField, error) {
+	if f, ok := binaryStructFieldsMap.Load(t); ok {
+		return f.([]binaryField), nil
+	}
+
+	var fields []binaryField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			return nil, maskAnyf(binaryUnsupportedError, "embedded field %s of %s", f.Name, t)
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := f.Name
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if tag != "" {
+			parts := strings.Split(tag, ",")
+			for _, option := range parts[1:] {
+				if option == "string" {
+					return nil, maskAnyf(binaryUnsupportedError, "string option of field %s of %s", f.Name, t)
+				}
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+		}
+
+		fields = append(fields, binaryField{index: i, name: name})
+	}
+
+	binaryStructFieldsMap.Store(t, fields)
+
+	return fields, nil
+}
+
+// binarySupported checks whether values of the given type can be encoded using
+// the binary value format without changing their meaning.
+func binarySupported(t reflect.Type) bool {
+	for _, i := range []reflect.Type{jsonMarshalerType, jsonUnmarshalerType, textMarshalerType, textUnmarshalerType} {
+		if t.Implements(i) || reflect.PointerTo(t).Implements(i) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// encodeBinaryValue writes the given value using the binary value format.
+// Lists, maps, structs and pointers may at most be nested depth levels deep.
+// Deeper values, e.g. cyclic ones, are not supported, so that they are encoded
+// using JSON, which reports cycles as errors.
+func encodeBinaryValue(buf *bytes.Buffer, v reflect.Value, depth int) error {
+	if !v.IsValid() {
+		buf.WriteByte(binaryValueNil)
+		return nil
+	}
+	if depth < 0 {
+		return maskAnyf(binaryUnsupportedError, "depth exceeds maximum")
+	}
+	if !binarySupported(v.Type()) {
+		return maskAnyf(binaryUnsupportedError, "type %s", v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(binaryValueTrue)
+		} else {
+			buf.WriteByte(binaryValueFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		buf.WriteByte(binaryValueInt)
+		writeBinaryVarint(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		buf.WriteByte(binaryValueUint)
+		writeBinaryUvarint(buf, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		buf.WriteByte(binaryValueFloat)
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(v.Float()))
+		buf.Write(b[:])
+	case reflect.String:
+		buf.WriteByte(binaryValueString)
+		writeBinaryString(buf, v.String())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return maskAnyf(binaryUnsupportedError, "type %s", v.Type())
+		}
+		if v.IsNil() {
+			buf.WriteByte(binaryValueNil)
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		buf.WriteByte(binaryValueList)
+		writeBinaryUvarint(buf, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			err := encodeBinaryValue(buf, v.Index(i), depth-1)
+			if err != nil {
+				return maskAny(err)
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return maskAnyf(binaryUnsupportedError, "type %s", v.Type())
+		}
+		if v.IsNil() {
+			buf.WriteByte(binaryValueNil)
+			return nil
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		buf.WriteByte(binaryValueMap)
+		writeBinaryUvarint(buf, uint64(len(keys)))
+		for _, k := range keys {
+			writeBinaryString(buf, k.String())
+			err := encodeBinaryValue(buf, v.MapIndex(k), depth-1)
+			if err != nil {
+				return maskAny(err)
+			}
+		}
+	case reflect.Struct:
+		fields, err := binaryFields(v.Type())
+		if err != nil {
+			return maskAny(err)
+		}
+		buf.WriteByte(binaryValueMap)
+		writeBinaryUvarint(buf, uint64(len(fields)))
+		for _, f := range fields {
+			writeBinaryString(buf, f.name)
+			err := encodeBinaryValue(buf, v.Field(f.index), depth-1)
+			if err != nil {
+				return maskAny(err)
+			}
+		}
+	case reflect.Pointer, reflect.Interface:
+		if v.Kind() == reflect.Interface && v.Type() != emptyInterfaceType {
+			return maskAnyf(binaryUnsupportedError, "type %s", v.Type())
+		}
+		if v.IsNil() {
+			buf.WriteByte(binaryValueNil)
+			return nil
+		}
+		err := encodeBinaryValue(buf, v.Elem(), depth-1)
+		if err != nil {
+			return maskAny(err)
+		}
+	default:
+		return maskAnyf(binaryUnsupportedError, "type %s", v.Type())
+	}
+
+	return nil
+}
+
+// decodeBinaryValue reads a value using the binary value format and stores it
+// in the given settable value. Values decoded into empty interfaces use the
+// generic types of encoding/json, i.e. bool, float64, string, []interface{}
+// and map[string]interface{}. Lists and maps may at most be nested depth
+// levels deep.
+func decodeBinaryValue(r *bytes.Reader, v reflect.Value, depth int) error {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return maskAny(err)
+	}
+
+	if tag == binaryValueNil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		err := r.UnreadByte()
+		if err != nil {
+			return maskAny(err)
+		}
+		err = decodeBinaryValue(r, v.Elem(), depth)
+		if err != nil {
+			return maskAny(err)
+		}
+		return nil
+	case reflect.Interface:
+		if v.Type() != emptyInterfaceType {
+			return maskAnyf(invalidValueError, "cannot decode into %s", v.Type())
+		}
+		g, err := decodeBinaryGeneric(r, tag, depth)
+		if err != nil {
+			return maskAny(err)
+		}
+		if g != nil {
+			v.Set(reflect.ValueOf(g))
+		}
+		return nil
+	}
+
+	if (tag == binaryValueList || tag == binaryValueMap) && depth <= 0 {
+		return maskAnyf(limitExceededError, "maximum depth exceeded")
+	}
+
+	switch tag {
+	case binaryValueFalse, binaryValueTrue:
+		if v.Kind() != reflect.Bool {
+			return maskAnyf(invalidValueError, "cannot decode bool into %s", v.Type())
+		}
+		v.SetBool(tag == binaryValueTrue)
+	case binaryValueInt:
+		i, err := binary.ReadVarint(r)
+		if err != nil {
+			return maskAny(err)
+		}
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.OverflowInt(i) {
+				return maskAnyf(invalidValueError, "%d overflows %s", i, v.Type())
+			}
+			v.SetInt(i)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if i < 0 || v.OverflowUint(uint64(i)) {
+				return maskAnyf(invalidValueError, "%d overflows %s", i, v.Type())
+			}
+			v.SetUint(uint64(i))
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(float64(i))
+		default:
+			return maskAnyf(invalidValueError, "cannot decode number into %s", v.Type())
+		}
+	case binaryValueUint:
+		u, err := binary.ReadUvarint(r)
+		if err != nil {
+			return maskAny(err)
+		}
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if u > math.MaxInt64 || v.OverflowInt(int64(u)) {
+				return maskAnyf(invalidValueError, "%d overflows %s", u, v.Type())
+			}
+			v.SetInt(int64(u))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if v.OverflowUint(u) {
+				return maskAnyf(invalidValueError, "%d overflows %s", u, v.Type())
+			}
+			v.SetUint(u)
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(float64(u))
+		default:
+			return maskAnyf(invalidValueError, "cannot decode number into %s", v.Type())
+		}
+	case binaryValueFloat:
+		f, err := readBinaryFloat(r)
+		if err != nil {
+			return maskAny(err)
+		}
+		if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+			return maskAnyf(invalidValueError, "cannot decode float into %s", v.Type())
+		}
+		v.SetFloat(f)
+	case binaryValueString:
+		s, err := readBinaryString(r)
+		if err != nil {
+			return maskAny(err)
+		}
+		if v.Kind() != reflect.String {
+			return maskAnyf(invalidValueError, "cannot decode string into %s", v.Type())
+		}
+		v.SetString(s)
+	case binaryValueList:
+		n, err := readBinaryLength(r)
+		if err != nil {
+			return maskAny(err)
+		}
+		switch v.Kind() {
+		case reflect.Slice:
+			v.Set(reflect.MakeSlice(v.Type(), n, n))
+		case reflect.Array:
+			v.Set(reflect.Zero(v.Type()))
+		default:
+			return maskAnyf(invalidValueError, "cannot decode list into %s", v.Type())
+		}
+		for i := 0; i < n; i++ {
+			if i < v.Len() {
+				err = decodeBinaryValue(r, v.Index(i), depth-1)
+			} else {
+				err = skipBinaryValue(r, depth-1)
+			}
+			if err != nil {
+				return maskAny(err)
+			}
+		}
+	case binaryValueMap:
+		n, err := readBinaryLength(r)
+		if err != nil {
+			return maskAny(err)
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return maskAnyf(invalidValueError, "cannot decode map into %s", v.Type())
+			}
+			m := reflect.MakeMapWithSize(v.Type(), n)
+			for i := 0; i < n; i++ {
+				k, err := readBinaryString(r)
+				if err != nil {
+					return maskAny(err)
+				}
+				e := reflect.New(v.Type().Elem()).Elem()
+				err = decodeBinaryValue(r, e, depth-1)
+				if err != nil {
+					return maskAny(err)
+				}
+				m.SetMapIndex(reflect.ValueOf(k).Convert(v.Type().Key()), e)
+			}
+			v.Set(m)
+		case reflect.Struct:
+			fields, err := binaryFields(v.Type())
+			if err != nil {
+				return maskAny(err)
+			}
+			v.Set(reflect.Zero(v.Type()))
+			for i := 0; i < n; i++ {
+				k, err := readBinaryString(r)
+				if err != nil {
+					return maskAny(err)
+				}
+				f, ok := binaryFieldByName(fields, k)
+				if ok {
+					err = decodeBinaryValue(r, v.Field(f.index), depth-1)
+				} else {
+					err = skipBinaryValue(r, depth-1)
+				}
+				if err != nil {
+					return maskAny(err)
+				}
+			}
+		default:
+			return maskAnyf(invalidValueError, "cannot decode map into %s", v.Type())
+		}
+	default:
+		return maskAnyf(invalidValueError, "unknown tag %d", tag)
+	}
+
+	return nil
+}
+
+// decodeBinaryGeneric reads the remainder of a value whose tag was already read
+// using the generic types of encoding/json.
+func decodeBinaryGeneric(r *bytes.Reader, tag byte, depth int) (interface{}, error) {
+	if (tag == binaryValueList || tag == binaryValueMap) && depth <= 0 {
+		return nil, maskAnyf(limitExceededError, "maximum depth exceeded")
+	}
+
+	switch tag {
+	case binaryValueNil:
+		return nil, nil
+	case binaryValueFalse, binaryValueTrue:
+		return tag == binaryValueTrue, nil
+	case binaryValueInt:
+		i, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		return float64(i), nil
+	case binaryValueUint:
+		u, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		return float64(u), nil
+	case binaryValueFloat:
+		f, err := readBinaryFloat(r)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		return f, nil
+	case binaryValueString:
+		s, err := readBinaryString(r)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		return s, nil
+	case binaryValueList:
+		n, err := readBinaryLength(r)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		l := make([]interface{}, n)
+		for i := range l {
+			err := decodeBinaryValue(r, reflect.ValueOf(&l[i]).Elem(), depth-1)
+			if err != nil {
+				return nil, maskAny(err)
+			}
+		}
+		return l, nil
+	case binaryValueMap:
+		n, err := readBinaryLength(r)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := readBinaryString(r)
+			if err != nil {
+				return nil, maskAny(err)
+			}
+			var e interface{}
+			err = decodeBinaryValue(r, reflect.ValueOf(&e).Elem(), depth-1)
+			if err != nil {
+				return nil, maskAny(err)
+			}
+			m[k] = e
+		}
+		return m, nil
+	}
+
+	return nil, maskAnyf(invalidValueError, "unknown tag %d", tag)
+}
+
+// binaryFieldByName returns the field having the given name. Like encoding/json
+// exact matches are preferred over case-insensitive matches.
+func binaryFieldByName(fields []binaryField, name string) (binaryField, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+
+	return binaryField{}, false
+}
+
+func skipBinaryValue(r *bytes.Reader, depth int) error {
+	var v interface{}
+	err := decodeBinaryValue(r, reflect.ValueOf(&v).Elem(), depth)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func readBinaryFloat(r *bytes.Reader) (float64, error) {
+	var b [8]byte
+	_, err := io.ReadFull(r, b[:])
+	if err != nil {
+		return 0, maskAny(err)
+	}
+
+	return math.Float64frombits(binary.LittleEndian.Uint64(b[:])), nil
+}
+
+// readBinaryLength reads the number of elements of a list or map. Each element
+// takes at least one byte, which bounds the length by the remaining bytes.
+func readBinaryLength(r *bytes.Reader) (int, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, maskAny(err)
+	}
+	if n > uint64(r.Len()) {
+		return 0, maskAnyf(invalidValueError, "length %d exceeds remaining %d bytes", n, r.Len())
+	}
+
+	return int(n), nil
+}
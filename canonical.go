@@ -0,0 +1,249 @@
+package context
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// NewCanonicalCodec creates a codec using the canonical form of the JSON
+// representation of contexts. The canonical form does not depend on the types
+// used to store information or on the version of Go. Object keys are sorted,
+// numbers are written as exact decimals without exponent, trailing zeros or
+// plus signs, strings only escape what JSON requires and there is no
+// insignificant whitespace. The canonical form can be decoded like any other
+// JSON representation. See Context.UnmarshalJSON.
+func NewCanonicalCodec() Codec {
+	return canonicalCodec{}
+}
+
+type canonicalCodec struct{}
+
+func (c canonicalCodec) Decode(ctx Context, b []byte) error {
+	err := ctx.UnmarshalJSON(b)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (c canonicalCodec) Encode(ctx Context) ([]byte, error) {
+	b, err := ctx.MarshalJSON()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	b, err = canonicalJSON(b)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return b, nil
+}
+
+// Fingerprint returns the hex encoded SHA-256 hash of the canonical form of the
+// information stored within the given context, including the versions of the
+// context values. Contexts storing the same information have the same
+// fingerprint, regardless of the process, the Go version or the storage they
+// were created with. Deadline and cancelation are not part of the fingerprint.
+// Context values of confidential keys are only encoded encrypted, so they
+// cannot be part of a fingerprint without leaking them. Fingerprinting contexts
+// storing them returns an error which can be asserted using IsInvalidExecution,
+// instead of ignoring them. See NewCanonicalCodec and RegisterConfidential.
+func Fingerprint(ctx Context) (string, error) {
+	b, err := ctx.MarshalJSON()
+	if err != nil {
+		return "", maskAny(err)
+	}
+
+	var w wire
+	err = json.Unmarshal(b, &w)
+	if err != nil {
+		return "", maskAny(err)
+	}
+	if len(w.Sealed) != 0 {
+		return "", maskAnyf(invalidExecutionError, "cannot fingerprint confidential information")
+	}
+
+	information := struct {
+		Storage  map[string]json.RawMessage `json:"storage"`
+		Versions map[string]int             `json:"versions,omitempty"`
+	}{
+		Storage:  w.Storage,
+		Versions: w.Versions,
+	}
+	b, err = json.Marshal(information)
+	if err != nil {
+		return "", maskAny(err)
+	}
+	b, err = canonicalJSON(b)
+	if err != nil {
+		return "", maskAny(err)
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalJSON returns the canonical form of the given JSON document. See
+// NewCanonicalCodec.
+func canonicalJSON(b []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	var v interface{}
+	err := d.Decode(&v)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	var buf bytes.Buffer
+	err = writeCanonical(&buf, v)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		if v {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case json.Number:
+		n, err := canonicalNumber(string(v))
+		if err != nil {
+			return maskAny(err)
+		}
+		buf.WriteString(n)
+	case string:
+		writeCanonicalString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i != 0 {
+				buf.WriteByte(',')
+			}
+			err := writeCanonical(buf, e)
+			if err != nil {
+				return maskAny(err)
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i != 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, k)
+			buf.WriteByte(':')
+			err := writeCanonical(buf, v[k])
+			if err != nil {
+				return maskAny(err)
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return maskAnyf(invalidValueError, "unexpected JSON value %T", v)
+	}
+
+	return nil
+}
+
+// canonicalNumber returns the exact decimal representation of the given JSON
+// number, e.g. 1, 1.0 and 10e-1 are all represented as 1.
+func canonicalNumber(s string) (string, error) {
+	// Exponents are bounded to prevent huge allocations caused by numbers like
+	// 1e1000000000. Go does not produce exponents beyond the range of float64.
+	if i := strings.IndexAny(s, "eE"); i >= 0 && len(strings.TrimLeft(s[i+1:], "+-0")) > 3 {
+		return "", maskAnyf(invalidValueError, "number %s out of range", s)
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return "", maskAnyf(invalidValueError, "invalid number %s", s)
+	}
+	if r.IsInt() {
+		return r.Num().String(), nil
+	}
+
+	// The denominator of a decimal number only has the prime factors 2 and 5.
+	// The number of digits required after the decimal point is the larger of
+	// their multiplicities.
+	var twos, fives int
+	d := new(big.Int).Set(r.Denom())
+	m := new(big.Int)
+	for {
+		q, rem := new(big.Int).QuoRem(d, big.NewInt(2), m)
+		if rem.Sign() != 0 {
+			break
+		}
+		d = q
+		twos++
+	}
+	for {
+		q, rem := new(big.Int).QuoRem(d, big.NewInt(5), m)
+		if rem.Sign() != 0 {
+			break
+		}
+		d = q
+		fives++
+	}
+
+	digits := twos
+	if fives > digits {
+		digits = fives
+	}
+
+	return r.FloatString(digits), nil
+}
+
+// writeCanonicalString writes the given string quoted, only escaping quotes,
+// backslashes and control characters.
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
@@ -0,0 +1,165 @@
+package context
+
+import (
+	nativecontext "context"
+	"testing"
+	"time"
+)
+
+func Test_canonicalJSON(t *testing.T) {
+	testCases := []struct {
+		Input    string
+		Expected string
+	}{
+		{
+			Input:    ` { "b" : 1 , "a" : [ true , false , null ] } `,
+			Expected: `{"a":[true,false,null],"b":1}`,
+		},
+		{
+			Input:    `[1, 1.0, 1e0, 10e-1, 0.10, -0, 1E+2, 1.5e-3]`,
+			Expected: `[1,1,1,1,0.1,0,100,0.0015]`,
+		},
+		{
+			Input:    `[12345678901234567890123, 0.1234567890123456789]`,
+			Expected: `[12345678901234567890123,0.1234567890123456789]`,
+		},
+		{
+			Input:    `"<html> \/ é \n \u0001 \" \\"`,
+			Expected: `"<html> / é \n \u0001 \" \\"`,
+		},
+		{
+			Input:    `{"b":{"d":1,"c":2},"a":{}}`,
+			Expected: `{"a":{},"b":{"c":2,"d":1}}`,
+		},
+	}
+
+	for i, testCase := range testCases {
+		b, err := canonicalJSON([]byte(testCase.Input))
+		if err != nil {
+			t.Fatal("case", i+1, "expected", nil, "got", err)
+		}
+		if string(b) != testCase.Expected {
+			t.Fatal("case", i+1, "expected", testCase.Expected, "got", string(b))
+		}
+	}
+
+	_, err := canonicalJSON([]byte(`1e1000000000`))
+	if !IsInvalidValue(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+}
+
+func Test_Fingerprint(t *testing.T) {
+	type one struct {
+		A string  `json:"a"`
+		B float64 `json:"b"`
+	}
+	type two struct {
+		B int    `json:"b"`
+		A string `json:"a"`
+	}
+
+	ctx1 := testNewContext(t)
+	ctx1.Create("value", one{A: "a", B: 1})
+
+	// The same information stored using different types, storages, deadlines
+	// and cancelation results in the same fingerprint.
+	nativeCtx, cancelFunc := nativecontext.WithDeadline(nativecontext.Background(), time.Now().Add(time.Hour))
+	defer cancelFunc()
+	config := DefaultConfig()
+	config.Context = nativeCtx
+	config.CopyOnWrite = true
+	ctx2, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	ctx2.Create("value", two{A: "a", B: 1})
+	ctx2.Create("other", 45.0)
+	ctx2.Create("foo", "bar")
+	ctx2.Cancel()
+
+	f1, err := Fingerprint(ctx1)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	f2, err := Fingerprint(ctx2)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if f1 != f2 {
+		t.Fatal("expected", f1, "got", f2)
+	}
+	f3, err := Fingerprint(testJSONRoundTrip(t, ctx1))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if f1 != f3 {
+		t.Fatal("expected", f1, "got", f3)
+	}
+
+	// The fingerprint must not change across processes and Go versions.
+	expected := "223d542df9f258332ab3fd6206b2f8b043fd162d6b29e7f17ad6c73e6d3b3dd4"
+	if f1 != expected {
+		t.Fatal("expected", expected, "got", f1)
+	}
+
+	// Different information results in different fingerprints.
+	ctx1.Create("foo", "baz")
+	f4, err := Fingerprint(ctx1)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if f1 == f4 {
+		t.Fatal("expected", "different fingerprints", "got", f4)
+	}
+}
+
+func Test_Fingerprint_Confidential(t *testing.T) {
+	keyring := testNewKeyring(t, "one", map[string][]byte{"one": testNewAESKey(t)})
+
+	// Contexts which only differ in their confidential information must not
+	// share a fingerprint, so they cannot be fingerprinted at all.
+	for _, session := range []string{"one", "two"} {
+		ctx := testNewKeyringContext(t, keyring)
+		ctx.Create("public", "public")
+		testConfidentialKey.NewContext(ctx, testConfidentialValue{Session: session})
+
+		_, err := Fingerprint(ctx)
+		if !IsInvalidExecution(err) {
+			t.Fatal("case", session, "expected", true, "got", false)
+		}
+	}
+
+	// Disabled confidential information is confidential as well.
+	ctx := testNewKeyringContext(t, keyring)
+	ctx = testConfidentialKey.Disable(testConfidentialKey.NewContext(ctx, testConfidentialValue{Session: "one"}))
+	_, err := Fingerprint(ctx)
+	if !IsInvalidExecution(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+}
+
+func Test_Codec_Canonical(t *testing.T) {
+	ctx := testNewContext(t)
+	ctx.Create("map", map[string]interface{}{"b": 1, "a": 2})
+
+	codec := NewCanonicalCodec()
+	b, err := codec.Encode(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	expected := `{"storage":{"foo":"bar","map":{"a":2,"b":1},"other":45},"version":1}`
+	if string(b) != expected {
+		t.Fatal("expected", expected, "got", string(b))
+	}
+
+	other := testNewContext(t)
+	other.Delete("foo")
+	err = codec.Decode(other, b)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if other.Search("foo") != "bar" {
+		t.Fatal("expected", "bar", "got", other.Search("foo"))
+	}
+}
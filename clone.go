@@ -0,0 +1,116 @@
+package context
+
+import (
+	"reflect"
+)
+
+// Cloner is implemented by context values which are able to create independent
+// copies of themselves. Context.Clone uses CloneValue to copy such context
+// values. All other context values are copied using reflection.
+type Cloner interface {
+	// CloneValue returns a deep copy of the current value. The returned value
+	// must not share any mutable memory with the current value.
+	CloneValue() interface{}
+}
+
+var clonerType = reflect.TypeOf((*Cloner)(nil)).Elem()
+
+// cloneValue returns a deep copy of the given context value.
+func cloneValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	return cloneReflectValue(reflect.ValueOf(v), map[visit]reflect.Value{}).Interface()
+}
+
+// visit identifies a pointer being copied. Pointers of different types may
+// share an address, e.g. a pointer to a struct and a pointer to its first
+// field, so the type is part of the identity.
+type visit struct {
+	p uintptr
+	t reflect.Type
+}
+
+// cloneReflectValue returns a deep copy of the given value. Pointers already
+// being copied are tracked using visited, so that cyclic and shared references
+// are preserved within the copy. Unexported struct fields are copied
+// shallowly, because they cannot be set using reflection. Channels and
+// functions are not copied at all.
+func cloneReflectValue(v reflect.Value, visited map[visit]reflect.Value) reflect.Value {
+	if v.CanInterface() && v.Type().Implements(clonerType) && !isNil(v) {
+		c := v.Interface().(Cloner).CloneValue()
+		if c != nil && reflect.TypeOf(c).AssignableTo(v.Type()) {
+			n := reflect.New(v.Type()).Elem()
+			n.Set(reflect.ValueOf(c))
+			return n
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		k := visit{p: v.Pointer(), t: v.Type()}
+		if c, ok := visited[k]; ok {
+			return c
+		}
+		n := reflect.New(v.Type().Elem())
+		visited[k] = n
+		n.Elem().Set(cloneReflectValue(v.Elem(), visited))
+		return n
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.New(v.Type()).Elem()
+		n.Set(cloneReflectValue(v.Elem(), visited))
+		return n
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			n.Index(i).Set(cloneReflectValue(v.Index(i), visited))
+		}
+		return n
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			n.SetMapIndex(cloneReflectValue(iter.Key(), visited), cloneReflectValue(iter.Value(), visited))
+		}
+		return n
+	case reflect.Array:
+		n := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			n.Index(i).Set(cloneReflectValue(v.Index(i), visited))
+		}
+		return n
+	case reflect.Struct:
+		n := reflect.New(v.Type()).Elem()
+		n.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if n.Field(i).CanSet() {
+				n.Field(i).Set(cloneReflectValue(v.Field(i), visited))
+			}
+		}
+		return n
+	default:
+		return v
+	}
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Pointer, reflect.Slice:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
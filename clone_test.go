@@ -0,0 +1,162 @@
+package context
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testCloneValue struct {
+	IDs    []string
+	Inner  *testCloneValue
+	Labels map[string][]string
+	Other  interface{}
+	secret []string
+}
+
+type testClonerValue struct {
+	IDs    []string
+	Cloned bool
+}
+
+func (v testClonerValue) CloneValue() interface{} {
+	return testClonerValue{
+		IDs:    append([]string(nil), v.IDs...),
+		Cloned: true,
+	}
+}
+
+func Test_cloneValue(t *testing.T) {
+	original := testCloneValue{
+		IDs: []string{"a", "b"},
+		Inner: &testCloneValue{
+			IDs: []string{"c"},
+		},
+		Labels: map[string][]string{
+			"foo": {"bar"},
+		},
+		Other:  []int{1, 2},
+		secret: []string{"secret"},
+	}
+
+	clone := cloneValue(original).(testCloneValue)
+	if !reflect.DeepEqual(clone, original) {
+		t.Fatal("expected", original, "got", clone)
+	}
+
+	// Modifying the clone should not modify the original.
+	clone.IDs[0] = "x"
+	clone.Inner.IDs[0] = "x"
+	clone.Labels["foo"][0] = "x"
+	clone.Other.([]int)[0] = 0
+
+	if original.IDs[0] != "a" {
+		t.Fatal("expected", "a", "got", original.IDs[0])
+	}
+	if original.Inner.IDs[0] != "c" {
+		t.Fatal("expected", "c", "got", original.Inner.IDs[0])
+	}
+	if original.Labels["foo"][0] != "bar" {
+		t.Fatal("expected", "bar", "got", original.Labels["foo"][0])
+	}
+	if original.Other.([]int)[0] != 1 {
+		t.Fatal("expected", 1, "got", original.Other.([]int)[0])
+	}
+}
+
+func Test_cloneValue_Cycle(t *testing.T) {
+	original := &testCloneValue{IDs: []string{"a"}}
+	original.Inner = original
+
+	clone := cloneValue(original).(*testCloneValue)
+	if clone == original {
+		t.Fatal("expected", "copy", "got", "original")
+	}
+	if clone.Inner != clone {
+		t.Fatal("expected", "cycle", "got", "no cycle")
+	}
+}
+
+func Test_cloneValue_Aliased(t *testing.T) {
+	type inner struct {
+		Name string
+	}
+	type outer struct {
+		B inner
+	}
+	type value struct {
+		P *outer
+		Q *inner
+	}
+
+	// Q points to the first field of the struct P points to, so both pointers
+	// share the same address while being of different types.
+	o := &outer{B: inner{Name: "name"}}
+	original := value{P: o, Q: &o.B}
+
+	clone := cloneValue(original).(value)
+	if clone.Q.Name != "name" {
+		t.Fatal("expected", "name", "got", clone.Q.Name)
+	}
+	if clone.P == original.P || clone.Q == original.Q {
+		t.Fatal("expected", "copies", "got", "shared pointers")
+	}
+
+	// Contexts clone such values as well.
+	ctx := testNewContext(t)
+	ctx.Create("aliased", original)
+	_, err := ctx.Clone()
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if Freeze(ctx).Search("aliased").(value).Q.Name != "name" {
+		t.Fatal("expected", "name", "got", Freeze(ctx).Search("aliased").(value).Q.Name)
+	}
+}
+
+func Test_cloneValue_Cloner(t *testing.T) {
+	original := testClonerValue{IDs: []string{"a"}}
+
+	clone := cloneValue(original).(testClonerValue)
+	if !clone.Cloned {
+		t.Fatal("expected", true, "got", false)
+	}
+
+	// Cloners are also used when being nested.
+	nested := cloneValue([]testClonerValue{original}).([]testClonerValue)
+	if !nested[0].Cloned {
+		t.Fatal("expected", true, "got", false)
+	}
+}
+
+func Test_cloneValue_Scalar(t *testing.T) {
+	testCases := []interface{}{
+		nil,
+		"foo",
+		45,
+		3.5,
+		true,
+	}
+
+	for i, testCase := range testCases {
+		clone := cloneValue(testCase)
+		if clone != testCase {
+			t.Fatal("case", i+1, "expected", testCase, "got", clone)
+		}
+	}
+}
+
+func Test_Clone_Deep(t *testing.T) {
+	ctx1 := testNewContext(t)
+	ctx1.Create("ids", []string{"a", "b"})
+
+	ctx2, err := ctx1.Clone()
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	ctx2.Search("ids").([]string)[0] = "x"
+
+	if ctx1.Search("ids").([]string)[0] != "a" {
+		t.Fatal("expected", "a", "got", ctx1.Search("ids").([]string)[0])
+	}
+}
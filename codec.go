@@ -0,0 +1,458 @@
+package context
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/juju/errgo"
+)
+
+// Codec encodes contexts to and decodes contexts from a specific wire format.
+// Different codecs can be chosen for different queues, while all of them
+// transport the same information, that is the stored information as well as
+// deadline and cancelation.
+type Codec interface {
+	// Decode merges the information of the given encoded context into the given
+	// context, like Context.UnmarshalJSON.
+	Decode(ctx Context, b []byte) error
+	// Encode returns the encoded representation of the given context.
+	Encode(ctx Context) ([]byte, error)
+}
+
+// NewJSONCodec creates a codec using the JSON representation of contexts. See
+// Context.MarshalJSON.
+func NewJSONCodec() Codec {
+	return jsonCodec{}
+}
+
+type jsonCodec struct{}
+
+func (c jsonCodec) Decode(ctx Context, b []byte) error {
+	err := ctx.UnmarshalJSON(b)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (c jsonCodec) Encode(ctx Context) ([]byte, error) {
+	b, err := ctx.MarshalJSON()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return b, nil
+}
+
+// NewBinaryCodec creates a codec using a compact binary representation of
+// contexts. Strings are length-prefixed and each context value is tagged with
+// the way it is encoded. Context values are encoded using a self-describing
+// binary format, which is decoded into the concrete types registered using
+// Register or NewKey. Context values of unregistered keys are restored using
+// the generic types of encoding/json, just like Context.UnmarshalJSON does.
+// Context values of keys having migrations or custom decode functions, and
+// context values implementing custom JSON or text encodings, are embedded as
+// JSON, so that they are migrated and decoded like Context.UnmarshalJSON does.
+// See RegisterMigrations.
+func NewBinaryCodec() Codec {
+	return binaryCodec{}
+}
+
+// binaryMagic identifies the binary representation of contexts.
+var binaryMagic = []byte("actx")
+
+const (
+	binaryFlagCanceled byte = 1 << iota
+	binaryFlagDeadline
+)
+
+const (
+	binaryTagValue byte = iota
+	binaryTagJSON
+	binaryTagSealed
+)
+
+type binaryCodec struct{}
+
+func (c binaryCodec) Decode(ctx Context, b []byte) error {
+	sc, err := statefulContext(ctx)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	limits := sc.getLimits()
+	err = limits.checkBytes(len(b))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	r := bytes.NewReader(b)
+
+	magic := make([]byte, len(binaryMagic))
+	_, err = io.ReadFull(r, magic)
+	if err != nil || !bytes.Equal(magic, binaryMagic) {
+		return maskAnyf(invalidValueError, "binary context must start with %q", binaryMagic)
+	}
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return maskAny(err)
+	}
+	if version > WireVersion {
+		return maskAnyf(versionMismatchError, "wire version %d is not supported, expected up to %d", version, WireVersion)
+	}
+
+	s := state{
+		Values: map[string]interface{}{},
+	}
+
+	flags, err := r.ReadByte()
+	if err != nil {
+		return maskAny(err)
+	}
+	s.Canceled = flags&binaryFlagCanceled != 0
+	if flags&binaryFlagDeadline != 0 {
+		nsec, err := binary.ReadVarint(r)
+		if err != nil {
+			return maskAny(err)
+		}
+		deadline := time.Unix(0, nsec)
+		s.Deadline = &deadline
+	}
+	s.Error, err = readBinaryString(r)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	n, err := readBinaryLength(r)
+	if err != nil {
+		return maskAny(err)
+	}
+	err = limits.checkKeys(n)
+	if err != nil {
+		return maskAny(err)
+	}
+	for i := 0; i < n; i++ {
+		k, err := readBinaryString(r)
+		if err != nil {
+			return maskAny(err)
+		}
+		v, err := readBinaryEntry(r, k, limits)
+		if err != nil {
+			return maskAny(err)
+		}
+		s.Values[k] = v
+	}
+
+	if r.Len() != 0 {
+		return maskAnyf(invalidValueError, "%d trailing bytes", r.Len())
+	}
+
+	err = sc.setState(s)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (c binaryCodec) Encode(ctx Context) ([]byte, error) {
+	sc, err := statefulContext(ctx)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	s, err := sc.getState()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(binaryMagic)
+	writeBinaryUvarint(&buf, WireVersion)
+
+	var flags byte
+	if s.Canceled {
+		flags |= binaryFlagCanceled
+	}
+	if s.Deadline != nil {
+		flags |= binaryFlagDeadline
+	}
+	buf.WriteByte(flags)
+	if s.Deadline != nil {
+		writeBinaryVarint(&buf, s.Deadline.UnixNano())
+	}
+	writeBinaryString(&buf, s.Error)
+
+	keys := make([]string, 0, len(s.Values))
+	for k := range s.Values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	writeBinaryUvarint(&buf, uint64(len(keys)))
+	for _, k := range keys {
+		writeBinaryString(&buf, k)
+		err := writeBinaryEntry(&buf, k, s.Values[k])
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// binaryDirect checks whether context values of the given key are decoded
+// directly from the binary value format. Otherwise they are decoded from JSON.
+// See NewBinaryCodec.
+func binaryDirect(key string) (reflect.Type, bool) {
+	decode, t, s := registration(key)
+	return t, s.empty() && (t != nil || decode == nil)
+}
+
+// readBinaryEntry reads the context value of the given key, enforcing the given
+// limits.
+func readBinaryEntry(r *bytes.Reader, key string, limits Limits) (interface{}, error) {
+	start := r.Len()
+
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	// Context values of confidential keys are always sealed when encoded.
+	// Plaintext ones are forged and must not be trusted.
+	if tag != binaryTagSealed && isConfidential(key) {
+		return nil, maskAnyf(invalidValueError, "key %s is confidential, but not sealed", key)
+	}
+
+	var raw []byte
+	var version int
+
+	switch tag {
+	case binaryTagValue:
+		t, direct := binaryDirect(key)
+		if direct && t != nil {
+			v := reflect.New(t).Elem()
+			err := decodeBinaryValue(r, v, limits.depth())
+			if err != nil {
+				return nil, maskBinaryEntry(key, err)
+			}
+			err = limits.checkValueBytes(key, start-r.Len())
+			if err != nil {
+				return nil, maskAny(err)
+			}
+			return v.Interface(), nil
+		}
+
+		var v interface{}
+		err := decodeBinaryValue(r, reflect.ValueOf(&v).Elem(), limits.depth())
+		if err != nil {
+			return nil, maskBinaryEntry(key, err)
+		}
+		err = limits.checkValueBytes(key, start-r.Len())
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		if direct {
+			return v, nil
+		}
+
+		// The encoding process did not know about migrations or custom decode
+		// functions of the current process, so the value is of version 0 and
+		// decoded from JSON.
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	case binaryTagJSON:
+		u, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		if u > math.MaxInt32 {
+			return nil, maskAnyf(versionMismatchError, "key %s: version %d is not supported", key, u)
+		}
+		version = int(u)
+		raw, err = readBinaryBytes(r)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		err = limits.checkValue(key, raw)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	case binaryTagSealed:
+		sv, err := readBinarySealed(r)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		err = limits.checkValueBytes(key, len(sv.Ciphertext))
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		return sv, nil
+	default:
+		return nil, maskAnyf(invalidValueError, "key %s: unknown tag %d", key, tag)
+	}
+
+	raw, err = migrateValue(key, version, raw)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	v, err := decodeValue(key, raw)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return v, nil
+}
+
+// maskBinaryEntry annotates the given error of decoding the context value of
+// the given key. Exceeded limits remain assertable using IsLimitExceeded.
+func maskBinaryEntry(key string, err error) error {
+	if IsLimitExceeded(err) {
+		return maskAnyf(limitExceededError, "key %s: %s", key, err.Error())
+	}
+
+	return maskAnyf(invalidValueError, "key %s: %s", key, err.Error())
+}
+
+// writeBinaryEntry writes the given context value of the given key.
+func writeBinaryEntry(buf *bytes.Buffer, key string, v interface{}) error {
+	if sv, ok := v.(sealedValue); ok {
+		buf.WriteByte(binaryTagSealed)
+		writeBinaryString(buf, sv.KeyID)
+		writeBinaryUvarint(buf, uint64(sv.Version))
+		writeBinaryBytes(buf, sv.Nonce)
+		writeBinaryBytes(buf, sv.Ciphertext)
+		return nil
+	}
+
+	t, direct := binaryDirect(key)
+	if direct && (t == nil || reflect.TypeOf(v) == t) {
+		var value bytes.Buffer
+		err := encodeBinaryValue(&value, reflect.ValueOf(v), maxDepth)
+		if err == nil {
+			buf.WriteByte(binaryTagValue)
+			buf.Write(value.Bytes())
+			return nil
+		} else if errgo.Cause(err) != binaryUnsupportedError {
+			return maskAny(err)
+		}
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return maskAny(err)
+	}
+	buf.WriteByte(binaryTagJSON)
+	writeBinaryUvarint(buf, uint64(valueVersion(key)))
+	writeBinaryBytes(buf, raw)
+
+	return nil
+}
+
+func readBinaryBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if n > uint64(r.Len()) {
+		return nil, maskAnyf(invalidValueError, "length %d exceeds remaining %d bytes", n, r.Len())
+	}
+
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return b, nil
+}
+
+func readBinarySealed(r *bytes.Reader) (sealedValue, error) {
+	var sv sealedValue
+	var err error
+
+	sv.KeyID, err = readBinaryString(r)
+	if err != nil {
+		return sealedValue{}, maskAny(err)
+	}
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return sealedValue{}, maskAny(err)
+	}
+	if version > math.MaxInt32 {
+		return sealedValue{}, maskAnyf(versionMismatchError, "version %d is not supported", version)
+	}
+	sv.Version = int(version)
+	sv.Nonce, err = readBinaryBytes(r)
+	if err != nil {
+		return sealedValue{}, maskAny(err)
+	}
+	sv.Ciphertext, err = readBinaryBytes(r)
+	if err != nil {
+		return sealedValue{}, maskAny(err)
+	}
+
+	return sv, nil
+}
+
+func readBinaryString(r *bytes.Reader) (string, error) {
+	b, err := readBinaryBytes(r)
+	if err != nil {
+		return "", maskAny(err)
+	}
+
+	return string(b), nil
+}
+
+func writeBinaryBytes(buf *bytes.Buffer, b []byte) {
+	writeBinaryUvarint(buf, uint64(len(b)))
+	buf.Write(b)
+}
+
+func writeBinaryString(buf *bytes.Buffer, s string) {
+	writeBinaryUvarint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func writeBinaryUvarint(buf *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func writeBinaryVarint(buf *bytes.Buffer, v int64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+// state is the codec independent representation of a context.
+type state struct {
+	Canceled bool
+	Deadline *time.Time
+	Error    string
+	Values   map[string]interface{}
+}
+
+// stateful is implemented by all contexts of this package, so that codecs are
+// able to access their state.
+type stateful interface {
+	getLimits() Limits
+	getState() (state, error)
+	setState(s state) error
+}
+
+func statefulContext(ctx Context) (stateful, error) {
+	sc, ok := ctx.(stateful)
+	if !ok {
+		return nil, maskAnyf(invalidExecutionError, "context must be created by this package")
+	}
+
+	return sc, nil
+}
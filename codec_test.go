@@ -0,0 +1,429 @@
+package context
+
+import (
+	nativecontext "context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Codec(t *testing.T) {
+	testCases := []struct {
+		Name  string
+		Codec Codec
+	}{
+		{
+			Name:  "json",
+			Codec: NewJSONCodec(),
+		},
+		{
+			Name:  "binary",
+			Codec: NewBinaryCodec(),
+		},
+	}
+
+	key := "github.com/the-anna-project/context/test"
+	expected := testValue{IDs: []string{"one", "two"}, Name: "name"}
+
+	for _, testCase := range testCases {
+		deadline := time.Now().Add(time.Hour)
+		nativeCtx, cancelFunc := nativecontext.WithDeadline(nativecontext.Background(), deadline)
+		defer cancelFunc()
+
+		config := DefaultConfig()
+		config.Context = nativeCtx
+		ctx, err := New(config)
+		if err != nil {
+			t.Fatal("case", testCase.Name, "expected", nil, "got", err)
+		}
+		ctx.Create(key, expected)
+		ctx.Create("string", "bar")
+		ctx.Create("map", map[string]interface{}{"foo": "bar"})
+		ctx.Create("nil", nil)
+
+		b, err := testCase.Codec.Encode(ctx)
+		if err != nil {
+			t.Fatal("case", testCase.Name, "expected", nil, "got", err)
+		}
+		other := testNewContext(t)
+		err = testCase.Codec.Decode(other, b)
+		if err != nil {
+			t.Fatal("case", testCase.Name, "expected", nil, "got", err)
+		}
+
+		if !reflect.DeepEqual(other.Search(key), expected) {
+			t.Fatal("case", testCase.Name, "expected", expected, "got", other.Search(key))
+		}
+		if other.Search("string") != "bar" {
+			t.Fatal("case", testCase.Name, "expected", "bar", "got", other.Search("string"))
+		}
+		if !reflect.DeepEqual(other.Search("map"), map[string]interface{}{"foo": "bar"}) {
+			t.Fatal("case", testCase.Name, "expected", map[string]interface{}{"foo": "bar"}, "got", other.Search("map"))
+		}
+		if _, ok := other.Search("nil").(interface{}); ok {
+			t.Fatal("case", testCase.Name, "expected", nil, "got", other.Search("nil"))
+		}
+		// The information of the decoding context is preserved.
+		if other.Search("other") == nil {
+			t.Fatal("case", testCase.Name, "expected", 45, "got", nil)
+		}
+
+		d, ok := other.Deadline()
+		if !ok {
+			t.Fatal("case", testCase.Name, "expected", true, "got", false)
+		}
+		if !d.Equal(deadline) {
+			t.Fatal("case", testCase.Name, "expected", deadline, "got", d)
+		}
+
+		// Cancelation is transported as well.
+		ctx.Cancel()
+		b, err = testCase.Codec.Encode(ctx)
+		if err != nil {
+			t.Fatal("case", testCase.Name, "expected", nil, "got", err)
+		}
+		other = testNewContext(t)
+		err = testCase.Codec.Decode(other, b)
+		if err != nil {
+			t.Fatal("case", testCase.Name, "expected", nil, "got", err)
+		}
+		if other.Err() != nativecontext.Canceled {
+			t.Fatal("case", testCase.Name, "expected", nativecontext.Canceled, "got", other.Err())
+		}
+
+		// Frozen contexts cannot be decoded into.
+		err = testCase.Codec.Decode(Freeze(testNewContext(t)), b)
+		if !IsReadOnly(err) {
+			t.Fatal("case", testCase.Name, "expected", true, "got", false)
+		}
+	}
+}
+
+// testCodecRegisteredJSON provides the JSON representations of context values
+// of keys being registered with custom decode functions, because their values
+// cannot be generated from their types. See Test_Codec_Registered.
+var testCodecRegisteredJSON = map[string]string{
+	"github.com/the-anna-project/context/current/expectation": `{"output":"output"}`,
+	"github.com/the-anna-project/context/test/key/interface":  `{"id":"id"}`,
+}
+
+func Test_Codec_Registered(t *testing.T) {
+	codecs := []Codec{
+		NewJSONCodec(),
+		NewBinaryCodec(),
+	}
+	keyring := testNewKeyring(t, "one", map[string][]byte{"one": testNewAESKey(t)})
+
+	registry.RLock()
+	decoders := map[string]DecodeFunc{}
+	for k, d := range registry.decoders {
+		decoders[k] = d
+	}
+	types := map[string]reflect.Type{}
+	for k, typ := range registry.types {
+		types[k] = typ
+	}
+	registry.RUnlock()
+
+	// The keys of this repository's packages are registered, see
+	// registered_test.go.
+	for _, k := range []string{"github.com/the-anna-project/context/current/behaviour", "github.com/the-anna-project/context/current/expectation"} {
+		if _, ok := decoders[k]; !ok {
+			t.Fatal("case", k, "expected", true, "got", false)
+		}
+	}
+
+	var keys []string
+	for k := range decoders {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var expected interface{}
+		if typ, ok := types[k]; ok {
+			expected = testFillValue(reflect.New(typ).Elem()).Interface()
+		} else {
+			raw, ok := testCodecRegisteredJSON[strings.TrimSuffix(k, "/restore")]
+			if !ok {
+				t.Fatal("case", k, "expected", "JSON representation", "got", nil)
+			}
+			var err error
+			expected, err = decoders[k]([]byte(raw))
+			if err != nil {
+				t.Fatal("case", k, "expected", nil, "got", err)
+			}
+		}
+
+		for i, codec := range codecs {
+			ctx := testNewKeyringContext(t, keyring)
+			ctx.Create(k, expected)
+
+			b, err := codec.Encode(ctx)
+			if err != nil {
+				t.Fatal("case", k, i+1, "expected", nil, "got", err)
+			}
+			other := testNewKeyringContext(t, keyring)
+			err = codec.Decode(other, b)
+			if err != nil {
+				t.Fatal("case", k, i+1, "expected", nil, "got", err)
+			}
+
+			// The context value should be restored using its concrete type.
+			if !reflect.DeepEqual(other.Search(k), expected) {
+				t.Fatal("case", k, i+1, "expected", expected, "got", other.Search(k))
+			}
+		}
+	}
+}
+
+// testFillValue sets all exported fields of the given settable value to values
+// other than their zero values and returns it.
+func testFillValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(45)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(45)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(3.5)
+	case reflect.String:
+		v.SetString("value")
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		testFillValue(v.Elem())
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		testFillValue(v.Index(0))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		key := testFillValue(reflect.New(v.Type().Key()).Elem())
+		v.SetMapIndex(key, testFillValue(reflect.New(v.Type().Elem()).Elem()))
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				testFillValue(v.Field(i))
+			}
+		}
+	}
+
+	return v
+}
+
+func Test_Codec_Binary_Cycle(t *testing.T) {
+	type testNode struct {
+		Name string
+		Next *testNode
+	}
+
+	n := &testNode{Name: "name"}
+	n.Next = n
+	ctx := testNewContext(t)
+	ctx.Create("cycle", n)
+
+	// Cyclic values fall back to JSON, which reports the cycle instead of
+	// overflowing the stack.
+	_, err := NewBinaryCodec().Encode(ctx)
+	if err == nil {
+		t.Fatal("expected", "error", "got", nil)
+	}
+	_, err = NewJSONCodec().Encode(ctx)
+	if err == nil {
+		t.Fatal("expected", "error", "got", nil)
+	}
+}
+
+func Test_Codec_Binary_Types(t *testing.T) {
+	type testStruct struct {
+		Hidden  string `json:"-"`
+		Name    string `json:"name"`
+		Pointer *int   `json:"pointer"`
+		Time    time.Time
+	}
+
+	ctx := testNewContext(t)
+	values := map[string]interface{}{
+		"bool":    true,
+		"bytes":   []byte("bytes"),
+		"float64": 3.5,
+		"int":     -45,
+		"int64":   int64(1) << 40,
+		"slice":   []interface{}{"a", 1.0, nil},
+		"string":  "bar",
+		"struct":  testStruct{Hidden: "hidden", Name: "name", Time: time.Unix(1, 0).UTC()},
+		"uint":    uint(45),
+	}
+	for k, v := range values {
+		ctx.Create(k, v)
+	}
+
+	jsonCtx := testJSONRoundTrip(t, ctx)
+
+	codec := NewBinaryCodec()
+	b, err := codec.Encode(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	other := testNewContext(t)
+	err = codec.Decode(other, b)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	// Values of unregistered keys are restored like using JSON.
+	for k := range values {
+		if !reflect.DeepEqual(other.Search(k), jsonCtx.Search(k)) {
+			t.Fatal("case", k, "expected", jsonCtx.Search(k), "got", other.Search(k))
+		}
+	}
+}
+
+var testCodecMigrationKey = MustNewKey(KeyConfig[testMigrationValue]{
+	Migrations: []Migration{
+		{
+			Upgrade: testMigrationRename("id", "name"),
+		},
+	},
+	Name:    "github.com/the-anna-project/context/test/codec/migration",
+	Version: 1,
+})
+
+func Test_Codec_Binary_Migration(t *testing.T) {
+	key := testCodecMigrationKey
+
+	// Values of keys having migrations are embedded as JSON, so that they can be
+	// migrated.
+	if _, direct := binaryDirect(key.Name()); direct {
+		t.Fatal("expected", false, "got", true)
+	}
+
+	codec := NewBinaryCodec()
+	expected := testMigrationValue{Name: "name", Type: "type"}
+	b, err := codec.Encode(key.NewContext(testNewContext(t), expected))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	other := testNewContext(t)
+	err = codec.Decode(other, b)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	val, _ := key.FromContext(other)
+	if val != expected {
+		t.Fatal("expected", expected, "got", val)
+	}
+}
+
+func Test_Codec_Binary_Invalid(t *testing.T) {
+	b, err := NewBinaryCodec().Encode(testNewContext(t))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	testCases := []struct {
+		Bytes        []byte
+		ErrorMatcher func(err error) bool
+	}{
+		{
+			Bytes:        nil,
+			ErrorMatcher: IsInvalidValue,
+		},
+		{
+			Bytes:        []byte(`{"storage":{}}`),
+			ErrorMatcher: IsInvalidValue,
+		},
+		{
+			Bytes:        append([]byte("actx"), 2),
+			ErrorMatcher: IsVersionMismatch,
+		},
+		{
+			Bytes:        b[:len(b)-1],
+			ErrorMatcher: func(err error) bool { return err != nil },
+		},
+	}
+
+	for i, testCase := range testCases {
+		err := NewBinaryCodec().Decode(testNewContext(t), testCase.Bytes)
+		if !testCase.ErrorMatcher(err) {
+			t.Fatal("case", i+1, "expected", true, "got", false)
+		}
+	}
+}
+
+func Benchmark_Codec(b *testing.B) {
+	testCases := []struct {
+		Name  string
+		Codec Codec
+	}{
+		{
+			Name:  "json",
+			Codec: NewJSONCodec(),
+		},
+		{
+			Name:  "binary",
+			Codec: NewBinaryCodec(),
+		},
+	}
+
+	ctx, err := New(DefaultConfig())
+	if err != nil {
+		b.Fatal("expected", nil, "got", err)
+	}
+	for i := 0; i < 10; i++ {
+		ctx.Create(fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i))
+	}
+	ctx.Create("github.com/the-anna-project/context/test", testValue{IDs: []string{"a", "b", "c"}, Name: "name"})
+
+	for _, testCase := range testCases {
+		encoded, err := testCase.Codec.Encode(ctx)
+		if err != nil {
+			b.Fatal("expected", nil, "got", err)
+		}
+
+		b.Run(testCase.Name+"/encode", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(encoded)))
+
+			for i := 0; i < b.N; i++ {
+				_, err := testCase.Codec.Encode(ctx)
+				if err != nil {
+					b.Fatal("expected", nil, "got", err)
+				}
+			}
+		})
+
+		b.Run(testCase.Name+"/decode", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(encoded)))
+
+			for i := 0; i < b.N; i++ {
+				other, err := New(DefaultConfig())
+				if err != nil {
+					b.Fatal("expected", nil, "got", err)
+				}
+				err = testCase.Codec.Decode(other, encoded)
+				if err != nil {
+					b.Fatal("expected", nil, "got", err)
+				}
+			}
+		})
+	}
+
+	// MarshalJSON is the baseline the codecs are compared against.
+	b.Run("marshaljson", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			_, err := json.Marshal(ctx)
+			if err != nil {
+				b.Fatal("expected", nil, "got", err)
+			}
+		}
+	})
+}
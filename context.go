@@ -1,11 +1,13 @@
-// Package context implements golang.org/x/net/context.Context and provides
-// marshallable context primitives to distribute information across event
-// queues.
+// Package context implements the context.Context interface of the standard
+// library and provides marshallable context primitives to distribute
+// information across event queues.
 package context
 
 import (
 	nativecontext "context"
 	"encoding/json"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -14,6 +16,21 @@ import (
 type Config struct {
 	// Settings.
 	Context nativecontext.Context
+	// CopyOnWrite configures the context to store its information within a
+	// persistent data structure. Cloning such a context takes constant time,
+	// because the information is shared between the context and its clone.
+	// Writes only copy the parts of the data structure being changed. Shared
+	// values are deeply copied on first access. Values retrieved before cloning
+	// must not be modified afterwards, because they may be shared with the
+	// clone. Clones inherit this setting.
+	CopyOnWrite bool
+	// Keyring encrypts context values of confidential keys when the context is
+	// encoded and decrypts them when they are accessed. Clones inherit this
+	// setting. See RegisterConfidential.
+	Keyring *Keyring
+	// Limits bounds the encoded contexts being decoded into the context. Clones
+	// inherit this setting. See Limits.
+	Limits Limits
 }
 
 // DefaultConfig provides a default configuration to create a new context by
@@ -21,7 +38,10 @@ type Config struct {
 func DefaultConfig() Config {
 	newConfig := Config{
 		// Settings.
-		Context: nativecontext.Background(),
+		Context:     nativecontext.Background(),
+		CopyOnWrite: false,
+		Keyring:     nil,
+		Limits:      DefaultLimits(),
 	}
 
 	return newConfig
@@ -36,72 +56,214 @@ func New(config Config) (Context, error) {
 
 	ctx, cancelFunc := nativecontext.WithCancel(config.Context)
 
+	var s storage
+	if config.CopyOnWrite {
+		s = newCOWStorage()
+	} else {
+		s = newMapStorage()
+	}
+
 	newContext := &context{
 		// Internals.
 		CancelFunc: cancelFunc,
 		CancelOnce: sync.Once{},
 		Context:    ctx,
-		Storage:    map[string]interface{}{},
+		Keyring:    config.Keyring,
+		Limits:     config.Limits,
+		Mutex:      sync.RWMutex{},
+		Storage:    s,
 	}
 
 	return newContext, nil
 }
 
+// WithDeadline returns a clone of the given context whose deadline is adjusted
+// to be no later than d. See Context.Clone.
+func WithDeadline(ctx Context, d time.Time) (Context, error) {
+	newContext, err := ctx.Clone()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	c, ok := newContext.(*context)
+	if !ok {
+		return nil, maskAnyf(invalidExecutionError, "clone must be created by New")
+	}
+
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+
+	deadlineCtx, deadlineCancelFunc := nativecontext.WithDeadline(c.Context, d)
+	cancelFunc := c.CancelFunc
+	c.Context = deadlineCtx
+	c.CancelFunc = func() {
+		deadlineCancelFunc()
+		cancelFunc()
+	}
+
+	return c, nil
+}
+
+// wire is the JSON representation of a context. See WireVersion.
+type wire struct {
+	Canceled bool                       `json:"canceled,omitempty"`
+	Deadline *time.Time                 `json:"deadline,omitempty"`
+	Error    string                     `json:"error,omitempty"`
+	Sealed   map[string]sealedValue     `json:"sealed,omitempty"`
+	Storage  map[string]json.RawMessage `json:"storage"`
+	Version  int                        `json:"version"`
+	Versions map[string]int             `json:"versions,omitempty"`
+}
+
 type context struct {
 	// Internals.
-	CancelFunc func()                 `json:"-"`
-	CancelOnce sync.Once              `json:"-"`
-	Context    nativecontext.Context  `json:"-"`
-	Storage    map[string]interface{} `json:"storage"`
+	CancelFunc func()                `json:"-"`
+	CancelOnce sync.Once             `json:"-"`
+	Context    nativecontext.Context `json:"-"`
+	Keyring    *Keyring              `json:"-"`
+	Limits     Limits                `json:"-"`
+	Mutex      sync.RWMutex          `json:"-"`
+	Storage    storage               `json:"storage"`
 }
 
 func (c *context) Cancel() {
+	c.Mutex.RLock()
+	cancelFunc := c.CancelFunc
+	c.Mutex.RUnlock()
+
 	c.CancelOnce.Do(func() {
-		c.CancelFunc()
+		cancelFunc()
 	})
 }
 
 func (c *context) Clone() (Context, error) {
-	newContext, err := New(DefaultConfig())
+	c.Mutex.RLock()
+	defer c.Mutex.RUnlock()
+
+	// The clone's underlying context is derived from the current one, so that
+	// canceling the current context cancels the clone as well.
+	config := DefaultConfig()
+	config.Context = c.Context
+	config.Keyring = c.Keyring
+	config.Limits = c.Limits
+	newContext, err := New(config)
 	if err != nil {
 		return nil, maskAny(err)
 	}
 
-	for k, v := range c.Storage {
-		newContext.(*context).Storage[k] = v
-	}
+	newContext.(*context).Storage = c.Storage.Clone()
 
 	return newContext, nil
 }
 
 func (c *context) Create(key string, value interface{}) {
-	c.Storage[key] = value
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+
+	c.Storage.Set(key, value)
 }
 
 func (c *context) Deadline() (time.Time, bool) {
+	c.Mutex.RLock()
+	defer c.Mutex.RUnlock()
+
 	return c.Context.Deadline()
 }
 
 func (c *context) Delete(key string) {
-	delete(c.Storage, key)
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+
+	c.Storage.Delete(key)
 }
 
 func (c *context) Done() <-chan struct{} {
+	c.Mutex.RLock()
+	defer c.Mutex.RUnlock()
+
 	return c.Context.Done()
 }
 
 func (c *context) Err() error {
+	c.Mutex.RLock()
+	defer c.Mutex.RUnlock()
+
 	return c.Context.Err()
 }
 
+func (c *context) Keys() []string {
+	c.Mutex.RLock()
+	defer c.Mutex.RUnlock()
+
+	keys := c.Storage.Keys()
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (c *context) KeysWithPrefix(prefix string) []string {
+	c.Mutex.RLock()
+	defer c.Mutex.RUnlock()
+
+	var keys []string
+	for _, k := range c.Storage.Keys() {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (c *context) Len() int {
+	c.Mutex.RLock()
+	defer c.Mutex.RUnlock()
+
+	return c.Storage.Len()
+}
+
+func (c *context) Namespace(prefix string) Context {
+	return newNamespace(c, prefix)
+}
+
 func (c *context) MarshalJSON() ([]byte, error) {
-	type ContextClone context
+	s, err := c.getState()
+	if err != nil {
+		return nil, maskAny(err)
+	}
 
-	b, err := json.Marshal(&struct {
-		*ContextClone
-	}{
-		ContextClone: (*ContextClone)(c),
-	})
+	w := wire{
+		Canceled: s.Canceled,
+		Deadline: s.Deadline,
+		Error:    s.Error,
+		Storage:  map[string]json.RawMessage{},
+		Version:  WireVersion,
+	}
+
+	for k, v := range s.Values {
+		if sv, ok := v.(sealedValue); ok {
+			if w.Sealed == nil {
+				w.Sealed = map[string]sealedValue{}
+			}
+			w.Sealed[k] = sv
+			continue
+		}
+
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		w.Storage[k] = b
+		if version := valueVersion(k); version != 0 {
+			if w.Versions == nil {
+				w.Versions = map[string]int{}
+			}
+			w.Versions[k] = version
+		}
+	}
+
+	b, err := json.Marshal(w)
 	if err != nil {
 		return nil, maskAny(err)
 	}
@@ -109,15 +271,72 @@ func (c *context) MarshalJSON() ([]byte, error) {
 	return b, nil
 }
 
+// UnmarshalJSON merges the information of the given JSON representation into
+// the current context. Context values are migrated to the versions produced by
+// the current process. See RegisterMigrations. Deadline and cancelation of the
+// encoded context are applied to the underlying native context, so that work
+// running on behalf of the current context stops in time.
 func (c *context) UnmarshalJSON(b []byte) error {
-	type ContextClone context
+	limits := c.getLimits()
+
+	err := limits.checkBytes(len(b))
+	if err != nil {
+		return maskAny(err)
+	}
+	// The context values are nested within the wire representation and its
+	// storage.
+	if d := jsonDepth(b) - 2; d > limits.depth() {
+		return maskAnyf(limitExceededError, "depth %d exceeds maximum of %d", d, limits.depth())
+	}
 
-	aux := &struct {
-		*ContextClone
-	}{
-		ContextClone: (*ContextClone)(c),
+	var w wire
+	err = json.Unmarshal(b, &w)
+	if err != nil {
+		return maskAny(err)
 	}
-	err := json.Unmarshal(b, &aux)
+	err = limits.checkKeys(len(w.Storage) + len(w.Sealed))
+	if err != nil {
+		return maskAny(err)
+	}
+	if w.Version < 0 || w.Version > WireVersion {
+		return maskAnyf(versionMismatchError, "wire version %d is not supported, expected up to %d", w.Version, WireVersion)
+	}
+
+	s := state{
+		Canceled: w.Canceled,
+		Deadline: w.Deadline,
+		Error:    w.Error,
+		Values:   map[string]interface{}{},
+	}
+	for k, raw := range w.Storage {
+		// Context values of confidential keys are always sealed when encoded.
+		// Plaintext ones are forged and must not be trusted.
+		if isConfidential(k) {
+			return maskAnyf(invalidValueError, "key %s is confidential, but not sealed", k)
+		}
+		err := limits.checkValue(k, raw)
+		if err != nil {
+			return maskAny(err)
+		}
+		raw, err := migrateValue(k, w.Versions[k], raw)
+		if err != nil {
+			return maskAny(err)
+		}
+		v, err := decodeValue(k, raw)
+		if err != nil {
+			return maskAny(err)
+		}
+		s.Values[k] = v
+	}
+	for k, sv := range w.Sealed {
+		err := limits.checkValueBytes(k, len(sv.Ciphertext))
+		if err != nil {
+			return maskAny(err)
+		}
+		s.Values[k] = sv
+	}
+
+	err = c.setState(s)
 	if err != nil {
 		return maskAny(err)
 	}
@@ -125,11 +344,215 @@ func (c *context) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// getLimits returns the limits of the current context.
+func (c *context) getLimits() Limits {
+	c.Mutex.RLock()
+	defer c.Mutex.RUnlock()
+
+	return c.Limits
+}
+
+// getState returns the codec independent representation of the current
+// context. Context values of confidential keys are sealed. The returned values
+// must not be modified.
+func (c *context) getState() (state, error) {
+	c.Mutex.RLock()
+	defer c.Mutex.RUnlock()
+
+	s := state{
+		Values: map[string]interface{}{},
+	}
+
+	if deadline, ok := c.Context.Deadline(); ok {
+		s.Deadline = &deadline
+	}
+	if err := c.Context.Err(); err != nil {
+		s.Canceled = true
+		s.Error = err.Error()
+	}
+
+	var err error
+	c.Storage.Range(func(k string, v interface{}) {
+		if err == nil {
+			s.Values[k], err = c.seal(k, v)
+		}
+	})
+	if err != nil {
+		return state{}, maskAny(err)
+	}
+
+	return s, nil
+}
+
+// setState merges the given codec independent representation into the current
+// context.
+func (c *context) setState(s state) error {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+
+	if c.Storage == nil {
+		c.Storage = newMapStorage()
+	}
+	for k, v := range s.Values {
+		c.Storage.Set(k, v)
+	}
+
+	c.unmarshalCancelation(s)
+
+	return nil
+}
+
+// unmarshalCancelation derives the underlying native context from the current
+// one using the deadline and cancelation of the given representation.
+// unmarshalCancelation must be called while holding the write lock.
+func (c *context) unmarshalCancelation(s state) {
+	ctx := c.Context
+	cancelFuncs := []func(){c.CancelFunc}
+
+	if s.Deadline != nil {
+		deadline := *s.Deadline
+		if s.Canceled && s.Error == nativecontext.DeadlineExceeded.Error() && time.Now().Before(deadline) {
+			// The deadline of the encoded context was exceeded, but the clock of
+			// the current process is behind. The error is preserved by using the
+			// current time as deadline.
+			deadline = time.Now()
+		}
+
+		var cancelFunc func()
+		ctx, cancelFunc = nativecontext.WithDeadline(ctx, deadline)
+		cancelFuncs = append(cancelFuncs, cancelFunc)
+	}
+
+	if s.Canceled && ctx.Err() == nil {
+		var cancelFunc func()
+		ctx, cancelFunc = nativecontext.WithCancel(ctx)
+		cancelFunc()
+		cancelFuncs = append(cancelFuncs, cancelFunc)
+	}
+
+	if len(cancelFuncs) == 1 {
+		return
+	}
+
+	c.Context = ctx
+	c.CancelFunc = func() {
+		for _, f := range cancelFuncs {
+			f()
+		}
+	}
+}
+
+func (c *context) Range(f func(key string, value interface{}) bool) {
+	c.Mutex.RLock()
+	keys := c.Storage.Keys()
+	sort.Strings(keys)
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		values[i], _ = c.Storage.Search(k)
+		values[i] = c.reveal(k, values[i])
+	}
+	c.Mutex.RUnlock()
+
+	for i, k := range keys {
+		if !f(k, values[i]) {
+			return
+		}
+	}
+}
+
 func (c *context) Search(key string) interface{} {
-	v, ok := c.Storage[key]
+	c.Mutex.RLock()
+	defer c.Mutex.RUnlock()
+
+	v, ok := c.Storage.Search(key)
 	if ok {
-		return v
+		return c.reveal(key, v)
 	}
 
 	return nil
 }
+
+func (c *context) Value(key interface{}) interface{} {
+	c.Mutex.RLock()
+	defer c.Mutex.RUnlock()
+
+	if k, ok := key.(string); ok {
+		v, ok := c.Storage.Search(k)
+		if ok {
+			return c.reveal(k, v)
+		}
+	}
+
+	return c.Context.Value(key)
+}
+
+// reveal returns the given context value of the given key, decrypting it in
+// case it is sealed. Sealed context values which cannot be decrypted using the
+// keyring of the current context are not revealed. reveal must be called while
+// holding the read lock.
+func (c *context) reveal(key string, v interface{}) interface{} {
+	sv, ok := v.(sealedValue)
+	if !ok {
+		return v
+	}
+	if c.Keyring == nil {
+		return nil
+	}
+
+	raw, err := c.Keyring.open(key, sv)
+	if err != nil {
+		return nil
+	}
+	raw, err = migrateValue(key, sv.Version, raw)
+	if err != nil {
+		return nil
+	}
+	v, err = decodeValue(key, raw)
+	if err != nil {
+		return nil
+	}
+
+	return v
+}
+
+// seal returns the given context value of the given key, encrypting it in case
+// the key is confidential. Sealed context values encrypted using a key other
+// than the current one of the keyring are encrypted again, so that keys can be
+// rotated while contexts are in flight. seal must be called while holding the
+// read lock.
+func (c *context) seal(key string, v interface{}) (interface{}, error) {
+	if sv, ok := v.(sealedValue); ok {
+		if c.Keyring == nil || sv.KeyID == c.Keyring.keyID {
+			return sv, nil
+		}
+		raw, err := c.Keyring.open(key, sv)
+		if err != nil {
+			// The value may be meant for other processes. It is passed on as it
+			// was received.
+			return sv, nil
+		}
+		sv, err = c.Keyring.seal(key, sv.Version, raw)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		return sv, nil
+	}
+
+	if !isConfidential(key) {
+		return v, nil
+	}
+	if c.Keyring == nil {
+		return nil, maskAnyf(invalidExecutionError, "key %s is confidential, but no keyring is configured", key)
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	sv, err := c.Keyring.seal(key, valueVersion(key), raw)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return sv, nil
+}
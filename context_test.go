@@ -4,6 +4,9 @@ import (
 	"bytes"
 	nativecontext "context"
 	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -16,24 +19,24 @@ func Test_Clone(t *testing.T) {
 	}
 
 	// Check that certain keys do not exist.
-	v, ok := ctx1.(*context).Storage["key"]
+	v, ok := ctx1.(*context).Storage.Search("key")
 	if ok {
 		t.Fatal("expected", false, "got", true)
 	}
-	v, ok = ctx2.(*context).Storage["key"]
+	v, ok = ctx2.(*context).Storage.Search("key")
 	if ok {
 		t.Fatal("expected", false, "got", true)
 	}
 
 	// Check that certain keys exist.
-	v, ok = ctx1.(*context).Storage["foo"]
+	v, ok = ctx1.(*context).Storage.Search("foo")
 	if !ok {
 		t.Fatal("expected", true, "got", false)
 	}
 	if v.(string) != "bar" {
 		t.Fatal("expected", "bar", "got", v.(string))
 	}
-	v, ok = ctx2.(*context).Storage["foo"]
+	v, ok = ctx2.(*context).Storage.Search("foo")
 	if !ok {
 		t.Fatal("expected", true, "got", false)
 	}
@@ -43,19 +46,126 @@ func Test_Clone(t *testing.T) {
 
 	ctx1.Create("key", "val")
 
-	v, ok = ctx1.(*context).Storage["key"]
+	v, ok = ctx1.(*context).Storage.Search("key")
 	if !ok {
 		t.Fatal("expected", true, "got", false)
 	}
 	if v.(string) != "val" {
 		t.Fatal("expected", "val", "got", v.(string))
 	}
-	v, ok = ctx2.(*context).Storage["key"]
+	v, ok = ctx2.(*context).Storage.Search("key")
 	if ok {
 		t.Fatal("expected", false, "got", true)
 	}
 }
 
+func Test_Clone_Cancel(t *testing.T) {
+	ctx1 := testNewContext(t)
+	ctx2, err := ctx1.Clone()
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	ctx3, err := ctx2.Clone()
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	// Canceling the clone should not cancel the original context.
+	ctx3.Cancel()
+
+	select {
+	case <-time.After(5 * time.Millisecond):
+		t.Fatal("expected", "cancel", "got", "timeout")
+	case <-ctx3.Done():
+	}
+	select {
+	case <-time.After(5 * time.Millisecond):
+	case <-ctx2.Done():
+		t.Fatal("expected", "timeout", "got", "cancel")
+	}
+
+	// Canceling the original context should cancel its clones.
+	ctx1.Cancel()
+
+	select {
+	case <-time.After(5 * time.Millisecond):
+		t.Fatal("expected", "cancel", "got", "timeout")
+	case <-ctx2.Done():
+	}
+	if ctx2.Err() != nativecontext.Canceled {
+		t.Fatal("expected", nativecontext.Canceled, "got", ctx2.Err())
+	}
+}
+
+func Test_Clone_Deadline(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+	nativeCtx, cancelFunc := nativecontext.WithDeadline(nativecontext.Background(), deadline)
+	defer cancelFunc()
+
+	config := DefaultConfig()
+	config.Context = nativeCtx
+	ctx1, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	ctx2, err := ctx1.Clone()
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	d, ok := ctx2.Deadline()
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if !d.Equal(deadline) {
+		t.Fatal("expected", deadline, "got", d)
+	}
+}
+
+func Test_WithDeadline(t *testing.T) {
+	ctx := testNewContext(t)
+
+	deadline := time.Now().Add(time.Hour)
+	other, err := WithDeadline(ctx, deadline)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	d, ok := other.Deadline()
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if !d.Equal(deadline) {
+		t.Fatal("expected", deadline, "got", d)
+	}
+	_, ok = ctx.Deadline()
+	if ok {
+		t.Fatal("expected", false, "got", true)
+	}
+	if other.Search("foo") != "bar" {
+		t.Fatal("expected", "bar", "got", other.Search("foo"))
+	}
+
+	// A later deadline does not extend the deadline of the given context.
+	other, err = WithDeadline(other, deadline.Add(time.Hour))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	d, _ = other.Deadline()
+	if !d.Equal(deadline) {
+		t.Fatal("expected", deadline, "got", d)
+	}
+
+	// An exceeded deadline cancels the context.
+	other, err = WithDeadline(ctx, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if other.Err() != nativecontext.DeadlineExceeded {
+		t.Fatal("expected", nativecontext.DeadlineExceeded, "got", other.Err())
+	}
+}
+
 func Test_JSON(t *testing.T) {
 	// Create new context and attach some information to it.
 	ctx := testNewContext(t)
@@ -89,14 +199,14 @@ func Test_JSON(t *testing.T) {
 	}
 
 	// Verify the values are actually the same.
-	v, ok := ctx.(*context).Storage["foo"]
+	v, ok := ctx.(*context).Storage.Search("foo")
 	if !ok {
 		t.Fatal("expected", true, "got", false)
 	}
 	if v != "bar" {
 		t.Fatal("expected", "bar", "got", v)
 	}
-	v, ok = other.(*context).Storage["foo"]
+	v, ok = other.(*context).Storage.Search("foo")
 	if !ok {
 		t.Fatal("expected", true, "got", false)
 	}
@@ -105,6 +215,97 @@ func Test_JSON(t *testing.T) {
 	}
 }
 
+func Test_JSON_Deadline(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+	nativeCtx, cancelFunc := nativecontext.WithDeadline(nativecontext.Background(), deadline)
+	defer cancelFunc()
+
+	config := DefaultConfig()
+	config.Context = nativeCtx
+	ctx, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	other := testJSONRoundTrip(t, ctx)
+
+	d, ok := other.Deadline()
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if !d.Equal(deadline) {
+		t.Fatal("expected", deadline, "got", d)
+	}
+	if other.Err() != nil {
+		t.Fatal("expected", nil, "got", other.Err())
+	}
+
+	// Canceling the unmarshalled context should still be possible.
+	other.Cancel()
+	if other.Err() != nativecontext.Canceled {
+		t.Fatal("expected", nativecontext.Canceled, "got", other.Err())
+	}
+}
+
+func Test_JSON_Deadline_Exceeded(t *testing.T) {
+	nativeCtx, cancelFunc := nativecontext.WithDeadline(nativecontext.Background(), time.Now().Add(-time.Second))
+	defer cancelFunc()
+
+	config := DefaultConfig()
+	config.Context = nativeCtx
+	ctx, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	other := testJSONRoundTrip(t, ctx)
+
+	select {
+	case <-time.After(5 * time.Millisecond):
+		t.Fatal("expected", "cancel", "got", "timeout")
+	case <-other.Done():
+	}
+	if other.Err() != nativecontext.DeadlineExceeded {
+		t.Fatal("expected", nativecontext.DeadlineExceeded, "got", other.Err())
+	}
+}
+
+func Test_JSON_Canceled(t *testing.T) {
+	ctx := testNewContext(t)
+	ctx.Cancel()
+
+	other := testJSONRoundTrip(t, ctx)
+
+	select {
+	case <-time.After(5 * time.Millisecond):
+		t.Fatal("expected", "cancel", "got", "timeout")
+	case <-other.Done():
+	}
+	if other.Err() != nativecontext.Canceled {
+		t.Fatal("expected", nativecontext.Canceled, "got", other.Err())
+	}
+	_, ok := other.Deadline()
+	if ok {
+		t.Fatal("expected", false, "got", true)
+	}
+}
+
+func Test_JSON_NotCanceled(t *testing.T) {
+	ctx := testNewContext(t)
+
+	other := testJSONRoundTrip(t, ctx)
+
+	select {
+	case <-time.After(5 * time.Millisecond):
+	case <-other.Done():
+		t.Fatal("expected", "timeout", "got", "cancel")
+	}
+	_, ok := other.Deadline()
+	if ok {
+		t.Fatal("expected", false, "got", true)
+	}
+}
+
 func Test_Cancel(t *testing.T) {
 	ctx := testNewContext(t)
 
@@ -158,6 +359,321 @@ func Test_Cancel_Underlying(t *testing.T) {
 	}
 }
 
+func Test_Concurrency(t *testing.T) {
+	ctx := testNewContext(t)
+	b, err := json.Marshal(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			key := fmt.Sprintf("key-%d", i)
+			for j := 0; j < 100; j++ {
+				ctx.Create(key, j)
+				ctx.Search(key)
+				ctx.Search("foo")
+
+				_, err := ctx.Clone()
+				if err != nil {
+					t.Error("expected", nil, "got", err)
+				}
+				_, err = json.Marshal(ctx)
+				if err != nil {
+					t.Error("expected", nil, "got", err)
+				}
+				err = json.Unmarshal(b, ctx)
+				if err != nil {
+					t.Error("expected", nil, "got", err)
+				}
+
+				ctx.Delete(key)
+				ctx.Deadline()
+				ctx.Err()
+				ctx.Done()
+			}
+
+			ctx.Cancel()
+		}(i)
+	}
+	wg.Wait()
+
+	// After all goroutines finished only the initial information should be
+	// left.
+	if ctx.Search("foo") != "bar" {
+		t.Fatal("expected", "bar", "got", ctx.Search("foo"))
+	}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if ctx.Search(key) != nil {
+			t.Fatal("expected", nil, "got", ctx.Search(key))
+		}
+	}
+	if ctx.Err() == nil {
+		t.Fatal("expected", "error", "got", nil)
+	}
+}
+
+func Test_Concurrency_CopyOnWrite(t *testing.T) {
+	config := DefaultConfig()
+	config.CopyOnWrite = true
+	ctx, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	ctx.Create("shared", []string{"one", "two"})
+
+	// Searching shared entries copies them while only the read lock of the
+	// context is held, so clones are searched and modified concurrently.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			key := fmt.Sprintf("key-%d", i)
+			for j := 0; j < 100; j++ {
+				clone, err := ctx.Clone()
+				if err != nil {
+					t.Error("expected", nil, "got", err)
+					return
+				}
+
+				for _, c := range []Context{ctx, clone} {
+					c.Create(key, []int{j})
+					c.Search(key)
+					c.Search("shared")
+					c.Range(func(key string, value interface{}) bool {
+						return true
+					})
+					c.Keys()
+					_, err = json.Marshal(c)
+					if err != nil {
+						t.Error("expected", nil, "got", err)
+					}
+					c.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	expected := []string{"shared"}
+	if !reflect.DeepEqual(ctx.Keys(), expected) {
+		t.Fatal("expected", expected, "got", ctx.Keys())
+	}
+	if !reflect.DeepEqual(ctx.Search("shared"), []string{"one", "two"}) {
+		t.Fatal("expected", []string{"one", "two"}, "got", ctx.Search("shared"))
+	}
+}
+
+func Test_Keys(t *testing.T) {
+	ctx := testNewContext(t)
+
+	expected := []string{"foo", "other"}
+	if !reflect.DeepEqual(ctx.Keys(), expected) {
+		t.Fatal("expected", expected, "got", ctx.Keys())
+	}
+
+	ctx.Create("bar", "baz")
+	ctx.Delete("other")
+
+	expected = []string{"bar", "foo"}
+	if !reflect.DeepEqual(ctx.Keys(), expected) {
+		t.Fatal("expected", expected, "got", ctx.Keys())
+	}
+}
+
+func Test_KeysWithPrefix(t *testing.T) {
+	ctx := testNewContext(t)
+	ctx.Create("github.com/the-anna-project/context/current/behaviour", "one")
+	ctx.Create("github.com/the-anna-project/context/current/source", "two")
+	ctx.Create("github.com/the-anna-project/context/first/behaviour", "three")
+	ctx.Create("github.com/the-anna-project/context/first/behaviour/restore", "four")
+	ctx.Create("github.com/the-anna-project/context/first/behaviourx", "five")
+
+	testCases := []struct {
+		Prefix   string
+		Expected []string
+	}{
+		{
+			Prefix: "github.com/the-anna-project/context/current/",
+			Expected: []string{
+				"github.com/the-anna-project/context/current/behaviour",
+				"github.com/the-anna-project/context/current/source",
+			},
+		},
+		{
+			Prefix: "github.com/the-anna-project/context/first/",
+			Expected: []string{
+				"github.com/the-anna-project/context/first/behaviour",
+				"github.com/the-anna-project/context/first/behaviour/restore",
+				"github.com/the-anna-project/context/first/behaviourx",
+			},
+		},
+		// Prefixes are matched literally, which includes sibling packages.
+		{
+			Prefix: "github.com/the-anna-project/context/first/behaviour",
+			Expected: []string{
+				"github.com/the-anna-project/context/first/behaviour",
+				"github.com/the-anna-project/context/first/behaviour/restore",
+				"github.com/the-anna-project/context/first/behaviourx",
+			},
+		},
+		// The trailing separator excludes sibling packages.
+		{
+			Prefix:   "github.com/the-anna-project/context/first/behaviour/",
+			Expected: []string{"github.com/the-anna-project/context/first/behaviour/restore"},
+		},
+		{
+			Prefix:   "github.com/the-anna-project/other/",
+			Expected: nil,
+		},
+		{
+			Prefix:   "",
+			Expected: ctx.Keys(),
+		},
+	}
+
+	for i, testCase := range testCases {
+		keys := ctx.KeysWithPrefix(testCase.Prefix)
+		if !reflect.DeepEqual(keys, testCase.Expected) {
+			t.Fatal("case", i+1, "expected", testCase.Expected, "got", keys)
+		}
+	}
+
+	// Namespaces list the information of a package, but no sibling packages.
+	keys := Namespace(ctx, "github.com/the-anna-project/context/first/behaviour").Keys()
+	if !reflect.DeepEqual(keys, []string{""}) {
+		t.Fatal("expected", []string{""}, "got", keys)
+	}
+}
+
+func Test_Len(t *testing.T) {
+	ctx := testNewContext(t)
+	if ctx.Len() != 2 {
+		t.Fatal("expected", 2, "got", ctx.Len())
+	}
+
+	ctx.Create("bar", "baz")
+	ctx.Create("foo", "baz")
+	if ctx.Len() != 3 {
+		t.Fatal("expected", 3, "got", ctx.Len())
+	}
+
+	ctx.Delete("bar")
+	if ctx.Len() != 2 {
+		t.Fatal("expected", 2, "got", ctx.Len())
+	}
+}
+
+func Test_Range(t *testing.T) {
+	ctx := testNewContext(t)
+	ctx.Create("bar", "baz")
+
+	var keys []string
+	var values []interface{}
+	ctx.Range(func(key string, value interface{}) bool {
+		keys = append(keys, key)
+		values = append(values, value)
+
+		// Modifying the context while ranging over it is allowed.
+		ctx.Delete(key)
+
+		return true
+	})
+	if !reflect.DeepEqual(keys, []string{"bar", "foo", "other"}) {
+		t.Fatal("expected", []string{"bar", "foo", "other"}, "got", keys)
+	}
+	if !reflect.DeepEqual(values, []interface{}{"baz", "bar", 45}) {
+		t.Fatal("expected", []interface{}{"baz", "bar", 45}, "got", values)
+	}
+	if ctx.Len() != 0 {
+		t.Fatal("expected", 0, "got", ctx.Len())
+	}
+
+	// Returning false stops ranging.
+	ctx = testNewContext(t)
+	var n int
+	ctx.Range(func(key string, value interface{}) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Fatal("expected", 1, "got", n)
+	}
+}
+
+func Test_Value(t *testing.T) {
+	type nativeKey string
+
+	nativeCtx := nativecontext.WithValue(nativecontext.Background(), nativeKey("native"), "native value")
+	nativeCtx = nativecontext.WithValue(nativeCtx, "string", "native string value")
+
+	config := DefaultConfig()
+	config.Context = nativeCtx
+	ctx, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	ctx.Create("foo", "bar")
+
+	// The context should be usable wherever a native context is expected.
+	var c nativecontext.Context = ctx
+
+	testCases := []struct {
+		Key      interface{}
+		Expected interface{}
+	}{
+		{
+			Key:      "foo",
+			Expected: "bar",
+		},
+		{
+			Key:      nativeKey("native"),
+			Expected: "native value",
+		},
+		{
+			Key:      "string",
+			Expected: "native string value",
+		},
+		{
+			Key:      "missing",
+			Expected: nil,
+		},
+		{
+			Key:      nativeKey("foo"),
+			Expected: nil,
+		},
+	}
+
+	for i, testCase := range testCases {
+		v := c.Value(testCase.Key)
+		if v != testCase.Expected {
+			t.Fatal("case", i+1, "expected", testCase.Expected, "got", v)
+		}
+	}
+
+	// Stored information should shadow the information of the native context.
+	ctx.Create("string", "stored string value")
+	v := c.Value("string")
+	if v != "stored string value" {
+		t.Fatal("expected", "stored string value", "got", v)
+	}
+
+	// Native contexts derived from the context should see its information.
+	derived, cancelFunc := nativecontext.WithCancel(ctx)
+	defer cancelFunc()
+	v = derived.Value("foo")
+	if v != "bar" {
+		t.Fatal("expected", "bar", "got", v)
+	}
+}
+
 func testNewContext(t *testing.T) Context {
 	var ctx Context
 	{
@@ -166,9 +682,84 @@ func testNewContext(t *testing.T) Context {
 		if err != nil {
 			t.Fatal("expected", nil, "got", err)
 		}
-		ctx.(*context).Storage["foo"] = "bar"
-		ctx.(*context).Storage["other"] = 45
+		ctx.(*context).Storage.Set("foo", "bar")
+		ctx.(*context).Storage.Set("other", 45)
 	}
 
 	return ctx
 }
+
+type testValue struct {
+	IDs  []string `json:"ids"`
+	Name string   `json:"name"`
+}
+
+func init() {
+	Register("github.com/the-anna-project/context/test", testValue{})
+}
+
+func Test_JSON_Register(t *testing.T) {
+	key := "github.com/the-anna-project/context/test"
+	expected := testValue{
+		IDs:  []string{"id1", "id2"},
+		Name: "name",
+	}
+
+	ctx := testNewContext(t)
+	ctx.Create(key, expected)
+
+	b, err := json.Marshal(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	other, err := New(DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = json.Unmarshal(b, other)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	// Registered values should be restored using their concrete type.
+	v, ok := other.Search(key).(testValue)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatal("expected", expected, "got", v)
+	}
+
+	// Unregistered values should be restored using the generic JSON types.
+	if other.Search("other") != float64(45) {
+		t.Fatal("expected", float64(45), "got", other.Search("other"))
+	}
+}
+
+func Test_JSON_Register_InvalidValue(t *testing.T) {
+	other, err := New(DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = json.Unmarshal([]byte(`{"storage":{"github.com/the-anna-project/context/test":"foo"}}`), other)
+	if !IsInvalidValue(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+}
+
+func testJSONRoundTrip(t *testing.T, ctx Context) Context {
+	b, err := json.Marshal(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	other, err := New(DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = json.Unmarshal(b, other)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return other
+}
@@ -0,0 +1,123 @@
+// Package correlation stores and accesses the values defined in this package
+// in and from a github.com/the-anna-project/context.Context. The correlation
+// identifies contexts which were split from a common context and belong
+// together when being merged again.
+package correlation
+
+import (
+	"github.com/the-anna-project/context"
+	"github.com/the-anna-project/gopkg"
+)
+
+// Value is the context value being managed by this package.
+type Value struct {
+	// ID represents the ID shared by all contexts of the current correlation.
+	ID string `json:"id"`
+	// Parents represents the IDs of the correlations enclosing the current
+	// correlation, outermost first. Splitting a context which already carries
+	// a correlation stacks its ID, so that nested splits can be merged again.
+	Parents []string `json:"parents,omitempty"`
+}
+
+// Equals checks whether the properties of the current value equals the
+// properties of the given value.
+func (v Value) Equals(other Value) bool {
+	if v.ID != other.ID {
+		return false
+	}
+	if len(v.Parents) != len(other.Parents) {
+		return false
+	}
+	for i, p := range v.Parents {
+		if p != other.Parents[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Child returns the value of a correlation enclosed by the current one using
+// the given ID.
+func (v Value) Child(id string) Value {
+	parents := make([]string, 0, len(v.Parents)+1)
+	parents = append(parents, v.Parents...)
+	parents = append(parents, v.ID)
+
+	return Value{ID: id, Parents: parents}
+}
+
+// Parent returns the value of the correlation enclosing the current one. The
+// second return value is false in case there is no enclosing correlation.
+func (v Value) Parent() (Value, bool) {
+	if len(v.Parents) == 0 {
+		return Value{}, false
+	}
+
+	last := len(v.Parents) - 1
+	parents := append([]string(nil), v.Parents[:last]...)
+	if len(parents) == 0 {
+		parents = nil
+	}
+
+	return Value{ID: v.Parents[last], Parents: parents}, true
+}
+
+// Key manages the context values of this package within a
+// github.com/the-anna-project/context.Context. Its name is the package path.
+var Key = context.MustNewKey(context.KeyConfig[Value]{
+	Equal: Value.Equals,
+	Name:  gopkg.String(),
+})
+
+// Disable removes the context value and backs it up, so that it can be
+// restored using Restore.
+func Disable(ctx context.Context) context.Context {
+	return Key.Disable(ctx)
+}
+
+// FromContext returns the context value stored in ctx, if any.
+func FromContext(ctx context.Context) (Value, bool) {
+	return Key.FromContext(ctx)
+}
+
+// IsDisabled checks whether the given context has the context value removed and
+// backed up.
+func IsDisabled(ctx context.Context) bool {
+	return Key.IsDisabled(ctx)
+}
+
+// NewContext returns a new github.com/the-anna-project/context.Context that
+// carries the context value val.
+func NewContext(ctx context.Context, val Value) context.Context {
+	return Key.NewContext(ctx, val)
+}
+
+// NewContextFromContexts sets the context value from the given list of contexts
+// to the given single context. Therefore all context values transported by all
+// contexts of the given list of contexts have to be equal. Merging the contexts
+// of a correlation closes it, so that the enclosing correlation, if any, is set
+// to the given context. This way merging the contexts of a nested split results
+// in contexts which can be merged with the other contexts of the outer split.
+func NewContextFromContexts(ctx context.Context, ctxs []context.Context) (context.Context, error) {
+	ctx, err := Key.NewContextFromContexts(ctx, ctxs)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	val, ok := FromContext(ctx)
+	if ok {
+		parent, ok := val.Parent()
+		if ok {
+			ctx = NewContext(ctx, parent)
+		}
+	}
+
+	return ctx, nil
+}
+
+// Restore sets the context value using the value being backed up by a previous
+// call to Disable.
+func Restore(ctx context.Context) context.Context {
+	return Key.Restore(ctx)
+}
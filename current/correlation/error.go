@@ -0,0 +1,17 @@
+package correlation
+
+import (
+	"github.com/juju/errgo"
+
+	"github.com/the-anna-project/context"
+)
+
+var (
+	maskAny = errgo.MaskFunc(errgo.Any)
+)
+
+// IsInvalidExecution asserts invalid execution errors returned by
+// NewContextFromContexts.
+func IsInvalidExecution(err error) bool {
+	return context.IsInvalidExecution(err)
+}
@@ -1,6 +1,7 @@
 package destination
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/the-anna-project/context"
@@ -57,22 +58,74 @@ func Test_Disable_Restore(t *testing.T) {
 	}
 }
 
+func Test_JSON(t *testing.T) {
+	ctx := testNewContext(t)
+	expected := testNewValue(t)
+	ctx = NewContext(ctx, expected)
+
+	// Marshal and unmarshal the context.
+	b, err := json.Marshal(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	other := testNewContext(t)
+	err = json.Unmarshal(b, other)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	// The context value should be restored using its concrete type.
+	val, ok := FromContext(other)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if !val.Equals(expected) {
+		t.Fatal("expected", expected, "got", val)
+	}
+
+	// A disabled context value should be restorable after unmarshalling.
+	ctx = Disable(ctx)
+	b, err = json.Marshal(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	other = testNewContext(t)
+	err = json.Unmarshal(b, other)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if !IsDisabled(other) {
+		t.Fatal("expected", true, "got", false)
+	}
+	other = Restore(other)
+	val, ok = FromContext(other)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if !val.Equals(expected) {
+		t.Fatal("expected", expected, "got", val)
+	}
+}
+
 func Test_NewContextFromContexts(t *testing.T) {
 	testCases := []struct {
 		Ctx          context.Context
 		Ctxs         []context.Context
 		ErrorMatcher func(err error) bool
 		Expected     Value
+		Found        bool
 	}{
-		// Everything is default. Everything should have zero values.
+		// Everything is default. No context carries a context value, so no context
+		// value is written.
 		{
 			Ctx:          testNewContext(t),
 			Ctxs:         testNewContexts(t),
 			ErrorMatcher: nil,
 			Expected:     Value{},
+			Found:        false,
 		},
-		// Given contexts have zero values. Merging should overwrite context value
-		// to zero value.
+		// Given contexts carry no context value. Merging should not overwrite the
+		// context value with a zero value.
 		{
 			Ctx: func() context.Context {
 				ctx := testNewContext(t)
@@ -81,7 +134,8 @@ func Test_NewContextFromContexts(t *testing.T) {
 			}(),
 			Ctxs:         testNewContexts(t),
 			ErrorMatcher: nil,
-			Expected:     Value{},
+			Expected:     testNewValue(t),
+			Found:        true,
 		},
 		// Overwriting the zero value of the context with some value should set the
 		// context value to this value.
@@ -94,6 +148,7 @@ func Test_NewContextFromContexts(t *testing.T) {
 			}(),
 			ErrorMatcher: nil,
 			Expected:     testNewValue(t),
+			Found:        true,
 		},
 		// Overwriting the context value with the context value should not change
 		// the context value.
@@ -110,6 +165,7 @@ func Test_NewContextFromContexts(t *testing.T) {
 			}(),
 			ErrorMatcher: nil,
 			Expected:     testNewValue(t),
+			Found:        true,
 		},
 		// Providing a list of contexts with different values causes the merge to
 		// fail.
@@ -122,6 +178,7 @@ func Test_NewContextFromContexts(t *testing.T) {
 			}(),
 			ErrorMatcher: IsInvalidExecution,
 			Expected:     Value{},
+			Found:        false,
 		},
 	}
 
@@ -135,8 +192,8 @@ func Test_NewContextFromContexts(t *testing.T) {
 			if !val.Equals(testCase.Expected) {
 				t.Fatal("case", i+1, "expected", testCase.Expected, "got", val)
 			}
-			if !ok {
-				t.Fatal("case", i+1, "expected", true, "got", false)
+			if ok != testCase.Found {
+				t.Fatal("case", i+1, "expected", testCase.Found, "got", ok)
 			}
 		}
 	}
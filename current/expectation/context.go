@@ -3,93 +3,84 @@
 package expectation
 
 import (
+	"encoding/json"
+
 	"github.com/the-anna-project/context"
 	"github.com/the-anna-project/expectation"
 	"github.com/the-anna-project/gopkg"
 )
 
-var (
-	// valueKey is the key for context values in
-	// github.com/the-anna-project/context.Context. Clients use
-	// expectation.NewContext and expectation.FromContext instead of using this
-	// key directly.
-	valueKey = gopkg.String()
+// decode restores an expectation from its JSON representation. The
+// expectation is rebuilt using its configuration, because
+// github.com/the-anna-project/expectation.Expectation is an interface.
+func decode(b []byte) (expectation.Expectation, error) {
+	if string(b) == "null" {
+		return nil, nil
+	}
 
-	// restoreKey is the key for restoring context values in
-	// github.com/the-anna-project/context.Context. Clients use
-	// expectation.Disable and expectation.Restore instead of using this key
-	// directly.
-	restoreKey = gopkg.String() + "/restore"
-)
+	config := expectation.DefaultConfig()
+	err := json.Unmarshal(b, &config)
+	if err != nil {
+		return nil, err
+	}
+	val, err := expectation.New(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return val, nil
+}
+
+// equal checks whether the given expectations are equal. Two missing
+// expectations are considered equal.
+func equal(a, b expectation.Expectation) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return a.Equals(b)
+}
+
+// Key manages the context values of this package within a
+// github.com/the-anna-project/context.Context. Its name is the package path.
+var Key = context.MustNewKey(context.KeyConfig[expectation.Expectation]{
+	Decode: decode,
+	Equal:  equal,
+	Name:   gopkg.String(),
+})
 
-// Disable removes the context value being stored using valueKey and backs it up
-// using restoreKey.
+// Disable removes the context value and backs it up, so that it can be
+// restored using Restore.
 func Disable(ctx context.Context) context.Context {
-	val, _ := FromContext(ctx)
-	ctx.Create(restoreKey, val)
-	ctx.Delete(valueKey)
-	return ctx
+	return Key.Disable(ctx)
 }
 
 // FromContext returns the context value stored in ctx, if any.
 func FromContext(ctx context.Context) (expectation.Expectation, bool) {
-	val, ok := ctx.Search(valueKey).(expectation.Expectation)
-	return val, ok
+	return Key.FromContext(ctx)
 }
 
 // IsDisabled checks whether the given context has the context value removed and
 // backed up.
 func IsDisabled(ctx context.Context) bool {
-	var ok bool
-
-	_, ok = ctx.Search(valueKey).(expectation.Expectation)
-	if ok {
-		return false
-	}
-	_, ok = ctx.Search(restoreKey).(expectation.Expectation)
-	if !ok {
-		return false
-	}
-
-	return true
+	return Key.IsDisabled(ctx)
 }
 
 // NewContext returns a new github.com/the-anna-project/context.Context that
 // carries the context value val.
 func NewContext(ctx context.Context, val expectation.Expectation) context.Context {
-	ctx.Create(valueKey, val)
-	return ctx
+	return Key.NewContext(ctx, val)
 }
 
 // NewContextFromContexts sets the context value from the given list of contexts
 // to the given single context. Therefore all context values transported by all
 // contexts of the given list of contexts have to be equal.
 func NewContextFromContexts(ctx context.Context, ctxs []context.Context) (context.Context, error) {
-	var reference expectation.Expectation
-
-	for i, c := range ctxs {
-		value, _ := FromContext(c)
-		if i == 0 {
-			reference = value
-		}
-		if value == nil && reference != nil {
-			return nil, maskAnyf(invalidExecutionError, "context values must be equal")
-		}
-		if value != nil && !value.Equals(reference) {
-			return nil, maskAnyf(invalidExecutionError, "context values must be equal")
-		}
-	}
-
-	ctx = NewContext(ctx, reference)
-
-	return ctx, nil
+	return Key.NewContextFromContexts(ctx, ctxs)
 }
 
 // Restore sets the context value using the value being backed up by a previous
 // call to Disable.
 func Restore(ctx context.Context) context.Context {
-	val, _ := ctx.Search(restoreKey).(expectation.Expectation)
-	ctx.Create(valueKey, val)
-	ctx.Delete(restoreKey)
-	return ctx
+	return Key.Restore(ctx)
 }
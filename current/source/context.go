@@ -30,88 +30,59 @@ func (v Value) Equals(other Value) bool {
 	return true
 }
 
-var (
-	// valueKey is the key for context values in
-	// github.com/the-anna-project/context.Context. Clients use source.NewContext
-	// and source.FromContext instead of using this key directly.
-	valueKey = gopkg.String()
+// merge concatenates the IDs and names of the given context values.
+func merge(values []Value) (Value, error) {
+	var val Value
 
-	// restoreKey is the key for restoring context values in
-	// github.com/the-anna-project/context.Context. Clients use source.Disable and
-	// source.Restore instead of using this key directly.
-	restoreKey = gopkg.String() + "/restore"
-)
+	for _, v := range values {
+		val.IDs = append(val.IDs, v.IDs...)
+		val.Names = append(val.Names, v.Names...)
+	}
+
+	return val, nil
+}
+
+// Key manages the context values of this package within a
+// github.com/the-anna-project/context.Context. Its name is the package path.
+var Key = context.MustNewKey(context.KeyConfig[Value]{
+	Equal: Value.Equals,
+	Merge: merge,
+	Name:  gopkg.String(),
+})
 
-// Disable removes the context value being stored using valueKey and backs it up
-// using restoreKey.
+// Disable removes the context value and backs it up, so that it can be
+// restored using Restore.
 func Disable(ctx context.Context) context.Context {
-	val, _ := FromContext(ctx)
-	ctx.Create(restoreKey, val)
-	ctx.Delete(valueKey)
-	return ctx
+	return Key.Disable(ctx)
 }
 
 // FromContext returns the context value stored in ctx, if any.
 func FromContext(ctx context.Context) (Value, bool) {
-	val, ok := ctx.Search(valueKey).(Value)
-	return val, ok
+	return Key.FromContext(ctx)
 }
 
 // IsDisabled checks whether the given context has the context value removed and
 // backed up.
 func IsDisabled(ctx context.Context) bool {
-	var ok bool
-
-	_, ok = ctx.Search(valueKey).(Value)
-	if ok {
-		return false
-	}
-	_, ok = ctx.Search(restoreKey).(Value)
-	if !ok {
-		return false
-	}
-
-	return true
+	return Key.IsDisabled(ctx)
 }
 
 // NewContext returns a new github.com/the-anna-project/context.Context that
 // carries the context value val.
 func NewContext(ctx context.Context, val Value) context.Context {
-	ctx.Create(valueKey, val)
-	return ctx
+	return Key.NewContext(ctx, val)
 }
 
 // NewContextFromContexts sets the context value from the given list of contexts
-// to the given single context. Therefore all context values transported by all
-// contexts of the given list of contexts have to be equal.
+// to the given single context. Therefore the IDs and names of all context
+// values transported by all contexts of the given list of contexts are
+// concatenated.
 func NewContextFromContexts(ctx context.Context, ctxs []context.Context) (context.Context, error) {
-	var allIDs []string
-	for _, c := range ctxs {
-		v, _ := FromContext(c)
-		allIDs = append(allIDs, v.IDs...)
-	}
-
-	var allNames []string
-	for _, c := range ctxs {
-		v, _ := FromContext(c)
-		allNames = append(allNames, v.Names...)
-	}
-
-	val := Value{
-		IDs:   allIDs,
-		Names: allNames,
-	}
-
-	ctx = NewContext(ctx, val)
-
-	return ctx, nil
+	return Key.NewContextFromContexts(ctx, ctxs)
 }
 
 // Restore sets the context value using the value being backed up by a previous
 // call to Disable.
 func Restore(ctx context.Context) context.Context {
-	val, _ := ctx.Search(restoreKey).(Value)
-	ctx.Create(valueKey, val)
-	ctx.Delete(restoreKey)
-	return ctx
+	return Key.Restore(ctx)
 }
@@ -1,30 +1,11 @@
 package source
 
 import (
-	"fmt"
-
-	"github.com/juju/errgo"
-)
-
-var (
-	maskAny = errgo.MaskFunc(errgo.Any)
+	"github.com/the-anna-project/context"
 )
 
-func maskAnyf(err error, f string, v ...interface{}) error {
-	if err == nil {
-		return nil
-	}
-
-	f = fmt.Sprintf("%s: %s", err.Error(), f)
-	newErr := errgo.WithCausef(nil, errgo.Cause(err), f, v...)
-	newErr.(*errgo.Err).SetLocation(1)
-
-	return newErr
-}
-
-var invalidExecutionError = errgo.New("invalid execution")
-
-// IsInvalidExecution asserts invalidExecutionError.
+// IsInvalidExecution asserts invalid execution errors returned by
+// NewContextFromContexts.
 func IsInvalidExecution(err error) bool {
-	return errgo.Cause(err) == invalidExecutionError
+	return context.IsInvalidExecution(err)
 }
@@ -2,6 +2,7 @@ package context
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/juju/errgo"
 )
@@ -28,3 +29,89 @@ var invalidConfigError = errgo.New("invalid config")
 func IsInvalidConfig(err error) bool {
 	return errgo.Cause(err) == invalidConfigError
 }
+
+var invalidValueError = errgo.New("invalid value")
+
+// IsInvalidValue asserts invalidValueError.
+func IsInvalidValue(err error) bool {
+	return errgo.Cause(err) == invalidValueError
+}
+
+var invalidExecutionError = errgo.New("invalid execution")
+
+// IsInvalidExecution asserts invalidExecutionError. It also asserts
+// ConflictError, because conflicts are invalid executions of merges.
+func IsInvalidExecution(err error) bool {
+	return errgo.Cause(err) == invalidExecutionError || IsConflict(err)
+}
+
+// ConflictError describes context values which cannot be merged. Values[i] is
+// the context value carried by the context at index Indexes[i] of the list of
+// contexts being merged. Contexts not carrying any value are represented by
+// nil.
+type ConflictError struct {
+	Indexes []int
+	Key     string
+	Reason  string
+	Values  []interface{}
+}
+
+func (e *ConflictError) Error() string {
+	var conflicts []string
+	for i, index := range e.Indexes {
+		conflicts = append(conflicts, fmt.Sprintf("context %d: %+v", index, e.Values[i]))
+	}
+
+	return fmt.Sprintf("%s: %s: key %s: %s", invalidExecutionError.Error(), e.Reason, e.Key, strings.Join(conflicts, ", "))
+}
+
+// IsConflict asserts ConflictError.
+func IsConflict(err error) bool {
+	_, ok := ConflictFromError(err)
+	return ok
+}
+
+// ConflictFromError returns the ConflictError causing err, if any.
+func ConflictFromError(err error) (*ConflictError, bool) {
+	if err == nil {
+		return nil, false
+	}
+
+	conflict, ok := errgo.Cause(err).(*ConflictError)
+	return conflict, ok
+}
+
+var alreadyRegisteredError = errgo.New("already registered")
+
+// IsAlreadyRegistered asserts alreadyRegisteredError.
+func IsAlreadyRegistered(err error) bool {
+	return errgo.Cause(err) == alreadyRegisteredError
+}
+
+var readOnlyError = errgo.New("read only")
+
+// IsReadOnly asserts readOnlyError.
+func IsReadOnly(err error) bool {
+	return errgo.Cause(err) == readOnlyError
+}
+
+var versionMismatchError = errgo.New("version mismatch")
+
+// IsVersionMismatch asserts versionMismatchError.
+func IsVersionMismatch(err error) bool {
+	return errgo.Cause(err) == versionMismatchError
+}
+
+var limitExceededError = errgo.New("limit exceeded")
+
+// IsLimitExceeded asserts limitExceededError.
+func IsLimitExceeded(err error) bool {
+	return errgo.Cause(err) == limitExceededError
+}
+
+var invalidSignatureError = errgo.New("invalid signature")
+
+// IsInvalidSignature asserts invalidSignatureError.
+func IsInvalidSignature(err error) bool {
+	return errgo.Cause(err) == invalidSignatureError
+}
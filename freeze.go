@@ -0,0 +1,171 @@
+package context
+
+import (
+	"time"
+)
+
+// Freeze returns a read-only view of the given context. The view reflects
+// modifications of the given context, but cannot be used to modify it. Create
+// and Delete of the view silently do nothing and UnmarshalJSON returns an
+// error, which can be asserted using IsReadOnly. Use the package level
+// functions Create and Delete to be notified about writes to read-only
+// contexts. The helpers of Key never modify frozen contexts either. See
+// Key.NewContext. Range, Search and Value return deep copies of the stored
+// information, so that modifications of the returned values do not affect the
+// given context. Cancel of the view does nothing,
+// because only the owner of a context is supposed to cancel it. Clone returns
+// a regular context, which can be modified again.
+func Freeze(ctx Context) Context {
+	if IsFrozen(ctx) {
+		return ctx
+	}
+
+	newContext := &frozen{
+		// Internals.
+		context: ctx,
+	}
+
+	return newContext
+}
+
+// IsFrozen checks whether the given context is a read-only view created by
+// Freeze.
+func IsFrozen(ctx Context) bool {
+	_, ok := ctx.(*frozen)
+	return ok
+}
+
+// Create stores the given key/value pair within the given context like
+// Context.Create. In case the given context is read-only, an error is returned
+// which can be asserted using IsReadOnly.
+func Create(ctx Context, key string, value interface{}) error {
+	if IsFrozen(ctx) {
+		return maskAnyf(readOnlyError, "cannot create key %s", key)
+	}
+
+	ctx.Create(key, value)
+
+	return nil
+}
+
+// Delete removes the given key from the given context like Context.Delete. In
+// case the given context is read-only, an error is returned which can be
+// asserted using IsReadOnly.
+func Delete(ctx Context, key string) error {
+	if IsFrozen(ctx) {
+		return maskAnyf(readOnlyError, "cannot delete key %s", key)
+	}
+
+	ctx.Delete(key)
+
+	return nil
+}
+
+type frozen struct {
+	// Internals.
+	context Context
+}
+
+func (f *frozen) Cancel() {}
+
+func (f *frozen) Clone() (Context, error) {
+	newContext, err := f.context.Clone()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return newContext, nil
+}
+
+func (f *frozen) Create(key string, value interface{}) {}
+
+func (f *frozen) Deadline() (time.Time, bool) {
+	return f.context.Deadline()
+}
+
+func (f *frozen) Delete(key string) {}
+
+func (f *frozen) Done() <-chan struct{} {
+	return f.context.Done()
+}
+
+func (f *frozen) Err() error {
+	return f.context.Err()
+}
+
+func (f *frozen) Keys() []string {
+	return f.context.Keys()
+}
+
+func (f *frozen) KeysWithPrefix(prefix string) []string {
+	return f.context.KeysWithPrefix(prefix)
+}
+
+func (f *frozen) Len() int {
+	return f.context.Len()
+}
+
+func (f *frozen) Namespace(prefix string) Context {
+	return Freeze(f.context.Namespace(prefix))
+}
+
+func (f *frozen) MarshalJSON() ([]byte, error) {
+	b, err := f.context.MarshalJSON()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return b, nil
+}
+
+func (f *frozen) UnmarshalJSON(b []byte) error {
+	return maskAnyf(readOnlyError, "cannot unmarshal into frozen context")
+}
+
+func (f *frozen) Range(fn func(key string, value interface{}) bool) {
+	f.context.Range(func(key string, value interface{}) bool {
+		return fn(key, cloneValue(value))
+	})
+}
+
+func (f *frozen) Search(key string) interface{} {
+	return cloneValue(f.context.Search(key))
+}
+
+func (f *frozen) Value(key interface{}) interface{} {
+	if k, ok := key.(string); ok {
+		v := f.context.Search(k)
+		if v != nil {
+			return cloneValue(v)
+		}
+	}
+
+	return f.context.Value(key)
+}
+
+func (f *frozen) getLimits() Limits {
+	sc, err := statefulContext(f.context)
+	if err != nil {
+		return DefaultLimits()
+	}
+
+	return sc.getLimits()
+}
+
+func (f *frozen) getState() (state, error) {
+	sc, err := statefulContext(f.context)
+	if err != nil {
+		return state{}, maskAny(err)
+	}
+
+	s, err := sc.getState()
+	if err != nil {
+		return state{}, maskAny(err)
+	}
+
+	return s, nil
+}
+
+func (f *frozen) setState(s state) error {
+	return maskAnyf(readOnlyError, "cannot decode into frozen context")
+}
@@ -0,0 +1,172 @@
+package context
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func Test_Freeze(t *testing.T) {
+	ctx := testNewContext(t)
+	ctx.Create("ids", []string{"a", "b"})
+
+	frozen := Freeze(ctx)
+	if !IsFrozen(frozen) {
+		t.Fatal("expected", true, "got", false)
+	}
+	if IsFrozen(ctx) {
+		t.Fatal("expected", false, "got", true)
+	}
+	if Freeze(frozen) != frozen {
+		t.Fatal("expected", "same view", "got", "new view")
+	}
+
+	// The view reflects the frozen context.
+	if frozen.Search("foo") != "bar" {
+		t.Fatal("expected", "bar", "got", frozen.Search("foo"))
+	}
+	ctx.Create("key", "val")
+	if frozen.Search("key") != "val" {
+		t.Fatal("expected", "val", "got", frozen.Search("key"))
+	}
+	if frozen.Value("key") != "val" {
+		t.Fatal("expected", "val", "got", frozen.Value("key"))
+	}
+	if len(frozen.Keys()) != 4 {
+		t.Fatal("expected", 4, "got", len(frozen.Keys()))
+	}
+	if frozen.Len() != 4 {
+		t.Fatal("expected", 4, "got", frozen.Len())
+	}
+	if len(frozen.KeysWithPrefix("k")) != 1 {
+		t.Fatal("expected", 1, "got", len(frozen.KeysWithPrefix("k")))
+	}
+
+	// Modifying searched values does not affect the frozen context.
+	frozen.Search("ids").([]string)[0] = "x"
+	frozen.Value("ids").([]string)[1] = "x"
+	frozen.Range(func(key string, value interface{}) bool {
+		if key == "ids" {
+			value.([]string)[0] = "x"
+		}
+		return true
+	})
+	if ctx.Search("ids").([]string)[0] != "a" {
+		t.Fatal("expected", "a", "got", ctx.Search("ids").([]string)[0])
+	}
+	if ctx.Search("ids").([]string)[1] != "b" {
+		t.Fatal("expected", "b", "got", ctx.Search("ids").([]string)[1])
+	}
+
+	// Canceling the view does not cancel the frozen context.
+	frozen.Cancel()
+	if ctx.Err() != nil {
+		t.Fatal("expected", nil, "got", ctx.Err())
+	}
+	ctx.Cancel()
+	if frozen.Err() == nil {
+		t.Fatal("expected", "error", "got", nil)
+	}
+}
+
+func Test_Freeze_Modify(t *testing.T) {
+	ctx := testNewContext(t)
+	frozen := Freeze(ctx)
+
+	err := Create(frozen, "key", "val")
+	if !IsReadOnly(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+	err = Delete(frozen, "foo")
+	if !IsReadOnly(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+	b, err := json.Marshal(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = json.Unmarshal(b, frozen)
+	if !IsReadOnly(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+
+	// Writes to the view are ignored without panicking.
+	frozen.Create("key", "val")
+	frozen.Delete("foo")
+
+	if ctx.Search("key") != nil {
+		t.Fatal("expected", nil, "got", ctx.Search("key"))
+	}
+	if ctx.Search("foo") != "bar" {
+		t.Fatal("expected", "bar", "got", ctx.Search("foo"))
+	}
+
+	// Regular contexts can be modified using the package level functions.
+	err = Create(ctx, "key", "val")
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = Delete(ctx, "foo")
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if ctx.Search("key") != "val" {
+		t.Fatal("expected", "val", "got", ctx.Search("key"))
+	}
+
+	// Clones of the view can be modified.
+	clone, err := frozen.Clone()
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = Create(clone, "other", "val")
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if ctx.Search("other") == "val" {
+		t.Fatal("expected", nil, "got", ctx.Search("other"))
+	}
+}
+
+var testFreezeKey = MustNewKey(KeyConfig[testKeyValue]{
+	Name: "github.com/the-anna-project/context/test/freeze/key",
+})
+
+func Test_Freeze_Key(t *testing.T) {
+	key := testFreezeKey
+
+	ctx := testNewContext(t)
+	key.NewContext(ctx, testKeyValue{ID: "one"})
+	frozen := Freeze(ctx)
+
+	// The helpers of keys return modified clones of frozen contexts instead of
+	// modifying them.
+	other := key.NewContext(frozen, testKeyValue{ID: "two"})
+	if IsFrozen(other) {
+		t.Fatal("expected", false, "got", true)
+	}
+	val, _ := key.FromContext(other)
+	if val.ID != "two" {
+		t.Fatal("expected", "two", "got", val.ID)
+	}
+	other = key.Disable(frozen)
+	if !key.IsDisabled(other) {
+		t.Fatal("expected", true, "got", false)
+	}
+	other = key.Restore(Freeze(other))
+	if key.IsDisabled(other) {
+		t.Fatal("expected", false, "got", true)
+	}
+	val, _ = key.FromContext(ctx)
+	if val.ID != "one" {
+		t.Fatal("expected", "one", "got", val.ID)
+	}
+	if key.IsDisabled(ctx) {
+		t.Fatal("expected", false, "got", true)
+	}
+
+	// Merging into frozen contexts fails.
+	_, err := key.NewContextFromContexts(frozen, []Context{testNewContext(t)})
+	if !IsReadOnly(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+}
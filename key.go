@@ -0,0 +1,296 @@
+package context
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// KeyConfig represents the configuration used to create a new key.
+type KeyConfig[T any] struct {
+	// Settings.
+
+	// Confidential causes context values to be encrypted when contexts are
+	// encoded. See RegisterConfidential.
+	Confidential bool
+	// Decode restores a context value from its JSON representation. Decode only
+	// needs to be configured for types which cannot be restored by encoding/json
+	// directly, e.g. interfaces.
+	Decode func(b []byte) (T, error)
+	// Equal checks whether two context values are equal. It defaults to
+	// reflect.DeepEqual.
+	Equal func(a, b T) bool
+	// Merge reduces the context values of a list of contexts to a single context
+	// value. Only the context values of contexts carrying one are passed. By
+	// default all contexts have to carry equal context values.
+	Merge func(values []T) (T, error)
+	// Migrations describe how the JSON representation of context values is
+	// converted between versions. See RegisterMigrations.
+	Migrations []Migration
+	// Name is the key used to store context values within a context. It should
+	// be the package path of the package managing the context values. See
+	// github.com/the-anna-project/gopkg.
+	Name string
+	// Version is the version of the JSON representation of context values
+	// produced by the current process. See RegisterMigrations.
+	Version int
+}
+
+// DefaultKeyConfig provides a default configuration to create a new key by
+// best effort.
+func DefaultKeyConfig[T any]() KeyConfig[T] {
+	newConfig := KeyConfig[T]{
+		// Settings.
+		Confidential: false,
+		Decode: func(b []byte) (T, error) {
+			var v T
+			err := json.Unmarshal(b, &v)
+			if err != nil {
+				return v, maskAny(err)
+			}
+
+			return v, nil
+		},
+		Equal: func(a, b T) bool {
+			return reflect.DeepEqual(a, b)
+		},
+		Merge:      nil,
+		Migrations: nil,
+		Name:       "",
+		Version:    0,
+	}
+
+	return newConfig
+}
+
+// NewKey creates a new configured key object. The key's names are registered
+// like using RegisterFunc and RegisterMigrations, so that its context values
+// are migrated and restored using their concrete type when being unmarshalled.
+func NewKey[T any](config KeyConfig[T]) (*Key[T], error) {
+	// Settings.
+	if config.Name == "" {
+		return nil, maskAnyf(invalidConfigError, "name must not be empty")
+	}
+
+	err := validateMigrations(config.Version, config.Migrations)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	// Values decoded using encoding/json directly can be restored using their
+	// concrete type. Custom decode functions may validate or construct values,
+	// so codecs must not bypass them.
+	var t reflect.Type
+	if config.Decode == nil && reflect.TypeOf((*T)(nil)).Elem().Kind() != reflect.Interface {
+		t = reflect.TypeOf((*T)(nil)).Elem()
+	}
+
+	defaults := DefaultKeyConfig[T]()
+	if config.Decode == nil {
+		config.Decode = defaults.Decode
+	}
+	if config.Equal == nil {
+		config.Equal = defaults.Equal
+	}
+
+	newKey := &Key[T]{
+		// Settings.
+		decode:      config.Decode,
+		equal:       config.Equal,
+		merge:       config.Merge,
+		name:        config.Name,
+		restoreName: config.Name + "/restore",
+	}
+
+	decode := func(b []byte) (interface{}, error) {
+		return newKey.decode(b)
+	}
+	s := schema{migrations: config.Migrations, version: config.Version}
+	err = register(decode, t, s, newKey.name, newKey.restoreName)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if config.Confidential {
+		RegisterConfidential(newKey.name, newKey.restoreName)
+	}
+
+	return newKey, nil
+}
+
+// MustNewKey is like NewKey but panics if the key cannot be created. It
+// simplifies the declaration of keys as package variables.
+func MustNewKey[T any](config KeyConfig[T]) *Key[T] {
+	newKey, err := NewKey(config)
+	if err != nil {
+		panic(err)
+	}
+
+	return newKey
+}
+
+// Key stores and accesses context values of type T in and from a Context.
+// Packages managing context values declare a single key and expose its
+// operations.
+type Key[T any] struct {
+	// Settings.
+	decode      func(b []byte) (T, error)
+	equal       func(a, b T) bool
+	merge       func(values []T) (T, error)
+	name        string
+	restoreName string
+}
+
+// Disable removes the context value being stored using the key's name and
+// backs it up using the key's restore name. Like NewContext, Disable returns a
+// modified clone of frozen contexts.
+func (k *Key[T]) Disable(ctx Context) Context {
+	ctx = writable(ctx)
+	val, _ := k.FromContext(ctx)
+	ctx.Create(k.restoreName, val)
+	ctx.Delete(k.name)
+	return ctx
+}
+
+// Equal checks whether the given context values are equal.
+func (k *Key[T]) Equal(a, b T) bool {
+	return k.equal(a, b)
+}
+
+// FromContext returns the context value stored in ctx, if any.
+func (k *Key[T]) FromContext(ctx Context) (T, bool) {
+	val, ok := ctx.Search(k.name).(T)
+	return val, ok
+}
+
+// IsDisabled checks whether the given context has the context value removed
+// and backed up.
+func (k *Key[T]) IsDisabled(ctx Context) bool {
+	var ok bool
+
+	_, ok = ctx.Search(k.name).(T)
+	if ok {
+		return false
+	}
+	_, ok = ctx.Search(k.restoreName).(T)
+	if !ok {
+		return false
+	}
+
+	return true
+}
+
+// Name returns the key used to store context values within a context.
+func (k *Key[T]) Name() string {
+	return k.name
+}
+
+// NewContext returns the given context carrying the context value val. In case
+// the given context is frozen, a modified clone is returned instead. See
+// Freeze.
+func (k *Key[T]) NewContext(ctx Context, val T) Context {
+	ctx = writable(ctx)
+	ctx.Create(k.name, val)
+	return ctx
+}
+
+// NewContextFromContexts sets the context value from the given list of
+// contexts to the given single context. Unless a merge function is configured,
+// all contexts of the given list of contexts have to carry equal context
+// values. Contexts not carrying any context value are not passed to the merge
+// function. In case no context carries a context value, the given context is
+// returned unchanged, so that zero values are never written on behalf of
+// absent information.
+func (k *Key[T]) NewContextFromContexts(ctx Context, ctxs []Context) (Context, error) {
+	if IsFrozen(ctx) {
+		return nil, maskAnyf(readOnlyError, "cannot merge into frozen context")
+	}
+
+	var indexes []int
+	var values []T
+	for i, c := range ctxs {
+		value, ok := k.FromContext(c)
+		if ok {
+			indexes = append(indexes, i)
+			values = append(values, value)
+		}
+	}
+
+	if len(values) == 0 {
+		return ctx, nil
+	}
+
+	var reference T
+	if k.merge != nil {
+		var err error
+		reference, err = k.merge(values)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	} else {
+		reference = values[0]
+
+		// The conflict lists the first context value along with all context
+		// values differing from it. Contexts not carrying any context value are
+		// represented by nil.
+		var conflicting bool
+		conflict := &ConflictError{
+			Key:    k.name,
+			Reason: "context values must be equal",
+		}
+		for i, c := range ctxs {
+			value, ok := k.FromContext(c)
+			if ok && k.equal(value, reference) {
+				if i == indexes[0] {
+					conflict.Indexes = append(conflict.Indexes, i)
+					conflict.Values = append(conflict.Values, value)
+				}
+				continue
+			}
+
+			conflicting = true
+			conflict.Indexes = append(conflict.Indexes, i)
+			if ok {
+				conflict.Values = append(conflict.Values, value)
+			} else {
+				conflict.Values = append(conflict.Values, nil)
+			}
+		}
+		if conflicting {
+			return nil, maskAny(conflict)
+		}
+	}
+
+	ctx = k.NewContext(ctx, reference)
+
+	return ctx, nil
+}
+
+// Restore sets the context value using the value being backed up by a
+// previous call to Disable. Like NewContext, Restore returns a modified clone of
+// frozen contexts.
+func (k *Key[T]) Restore(ctx Context) Context {
+	ctx = writable(ctx)
+	val, _ := ctx.Search(k.restoreName).(T)
+	ctx.Create(k.name, val)
+	ctx.Delete(k.restoreName)
+	return ctx
+}
+
+// RestoreName returns the key used to back up context values within a context.
+func (k *Key[T]) RestoreName() string {
+	return k.restoreName
+}
+
+// writable returns the given context, or a clone of it in case it is frozen,
+// so that the helpers of keys never write to read-only contexts.
+func writable(ctx Context) Context {
+	if !IsFrozen(ctx) {
+		return ctx
+	}
+
+	newContext, err := ctx.Clone()
+	if err != nil {
+		return ctx
+	}
+
+	return newContext
+}
@@ -0,0 +1,243 @@
+package context
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testKeyValue struct {
+	ID    string   `json:"id"`
+	Types []string `json:"types"`
+}
+
+type testKeyInterface interface {
+	GetID() string
+}
+
+type testKeyImplementation struct {
+	ID string `json:"id"`
+}
+
+func (i testKeyImplementation) GetID() string {
+	return i.ID
+}
+
+// The test keys are registered once, because the registry is global to the
+// process and tests may run multiple times, e.g. using go test -count.
+var (
+	testKeyDisable = MustNewKey(KeyConfig[testKeyValue]{
+		Name: "github.com/the-anna-project/context/test/key/disable",
+	})
+	testKeyInterfaceKey = MustNewKey(KeyConfig[testKeyInterface]{
+		Decode: func(b []byte) (testKeyInterface, error) {
+			var i testKeyImplementation
+			err := json.Unmarshal(b, &i)
+			if err != nil {
+				return nil, err
+			}
+			return i, nil
+		},
+		Name: "github.com/the-anna-project/context/test/key/interface",
+	})
+	testKeyJSON = MustNewKey(KeyConfig[testKeyValue]{
+		Name: "github.com/the-anna-project/context/test/key/json",
+	})
+	testKeyMerged = MustNewKey(KeyConfig[testKeyValue]{
+		Merge: func(values []testKeyValue) (testKeyValue, error) {
+			var val testKeyValue
+			for _, v := range values {
+				val.Types = append(val.Types, v.Types...)
+			}
+			return val, nil
+		},
+		Name: "github.com/the-anna-project/context/test/key/merged",
+	})
+	testKeyName = MustNewKey(KeyConfig[testKeyValue]{
+		Name: "github.com/the-anna-project/context/test/key/name",
+	})
+	testKeyStrict = MustNewKey(KeyConfig[testKeyValue]{
+		Name: "github.com/the-anna-project/context/test/key/strict",
+	})
+)
+
+func Test_Key_New(t *testing.T) {
+	config := DefaultKeyConfig[testKeyValue]()
+	_, err := NewKey(config)
+	if !IsInvalidConfig(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+
+	config.Name = testKeyName.Name()
+	_, err = NewKey(config)
+	if !IsAlreadyRegistered(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+}
+
+func Test_Key_Disable_Restore(t *testing.T) {
+	key := testKeyDisable
+	ctx := testNewContext(t)
+	expected := testKeyValue{ID: "id", Types: []string{"one"}}
+
+	_, ok := key.FromContext(ctx)
+	if ok {
+		t.Fatal("expected", false, "got", true)
+	}
+
+	ctx = key.NewContext(ctx, expected)
+	if key.IsDisabled(ctx) {
+		t.Fatal("expected", false, "got", true)
+	}
+
+	ctx = key.Disable(ctx)
+	if !key.IsDisabled(ctx) {
+		t.Fatal("expected", true, "got", false)
+	}
+	_, ok = key.FromContext(ctx)
+	if ok {
+		t.Fatal("expected", false, "got", true)
+	}
+
+	ctx = key.Restore(ctx)
+	if key.IsDisabled(ctx) {
+		t.Fatal("expected", false, "got", true)
+	}
+	val, ok := key.FromContext(ctx)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if !key.Equal(val, expected) {
+		t.Fatal("expected", expected, "got", val)
+	}
+}
+
+func Test_Key_NewContextFromContexts(t *testing.T) {
+	strict := testKeyStrict
+	merged := testKeyMerged
+
+	ctxs := []Context{testNewContext(t), testNewContext(t)}
+	strict.NewContext(ctxs[0], testKeyValue{ID: "one", Types: []string{"one"}})
+	strict.NewContext(ctxs[1], testKeyValue{ID: "two", Types: []string{"two"}})
+	merged.NewContext(ctxs[0], testKeyValue{Types: []string{"one"}})
+	merged.NewContext(ctxs[1], testKeyValue{Types: []string{"two"}})
+
+	_, err := strict.NewContextFromContexts(testNewContext(t), ctxs)
+	if !IsInvalidExecution(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+	conflict, ok := ConflictFromError(err)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if conflict.Key != strict.Name() {
+		t.Fatal("expected", strict.Name(), "got", conflict.Key)
+	}
+	if !reflect.DeepEqual(conflict.Indexes, []int{0, 1}) {
+		t.Fatal("expected", []int{0, 1}, "got", conflict.Indexes)
+	}
+	if conflict.Values[1].(testKeyValue).ID != "two" {
+		t.Fatal("expected", "two", "got", conflict.Values[1])
+	}
+	if !strings.Contains(err.Error(), strict.Name()) {
+		t.Fatal("expected", true, "got", false)
+	}
+
+	ctx, err := merged.NewContextFromContexts(testNewContext(t), ctxs)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	val, _ := merged.FromContext(ctx)
+	if !reflect.DeepEqual(val.Types, []string{"one", "two"}) {
+		t.Fatal("expected", []string{"one", "two"}, "got", val.Types)
+	}
+	// Contexts not carrying a context value are reported as nil, not as zero
+	// values, and are not passed to merge functions.
+	ctxs = append([]Context{testNewContext(t)}, ctxs...)
+	_, err = strict.NewContextFromContexts(testNewContext(t), ctxs)
+	conflict, ok = ConflictFromError(err)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if !reflect.DeepEqual(conflict.Indexes, []int{0, 1, 2}) {
+		t.Fatal("expected", []int{0, 1, 2}, "got", conflict.Indexes)
+	}
+	if conflict.Values[0] != nil {
+		t.Fatal("expected", nil, "got", conflict.Values[0])
+	}
+	if conflict.Values[1].(testKeyValue).ID != "one" {
+		t.Fatal("expected", "one", "got", conflict.Values[1])
+	}
+	ctx, err = merged.NewContextFromContexts(testNewContext(t), ctxs)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	val, _ = merged.FromContext(ctx)
+	if !reflect.DeepEqual(val.Types, []string{"one", "two"}) {
+		t.Fatal("expected", []string{"one", "two"}, "got", val.Types)
+	}
+
+	// Zero values are never written on behalf of absent information.
+	for _, list := range [][]Context{nil, {testNewContext(t), testNewContext(t)}} {
+		ctx, err = strict.NewContextFromContexts(testNewContext(t), list)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		if _, ok := strict.FromContext(ctx); ok {
+			t.Fatal("expected", false, "got", true)
+		}
+		ctx, err = merged.NewContextFromContexts(testNewContext(t), list)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		if _, ok := merged.FromContext(ctx); ok {
+			t.Fatal("expected", false, "got", true)
+		}
+	}
+}
+
+func Test_Key_JSON(t *testing.T) {
+	key := testKeyJSON
+	interfaceKey := testKeyInterfaceKey
+
+	ctx := testNewContext(t)
+	ctx = key.NewContext(ctx, testKeyValue{ID: "id"})
+	ctx = interfaceKey.NewContext(ctx, testKeyImplementation{ID: "id"})
+	ctx = interfaceKey.Disable(ctx)
+
+	other := testJSONRoundTrip(t, ctx)
+
+	val, ok := key.FromContext(other)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if val.ID != "id" {
+		t.Fatal("expected", "id", "got", val.ID)
+	}
+	if !interfaceKey.IsDisabled(other) {
+		t.Fatal("expected", true, "got", false)
+	}
+	other = interfaceKey.Restore(other)
+	i, ok := interfaceKey.FromContext(other)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if i.GetID() != "id" {
+		t.Fatal("expected", "id", "got", i.GetID())
+	}
+}
+
+func Test_Key_Name(t *testing.T) {
+	key := testKeyName
+
+	if key.Name() != "github.com/the-anna-project/context/test/key/name" {
+		t.Fatal("expected", "github.com/the-anna-project/context/test/key/name", "got", key.Name())
+	}
+	if !strings.HasPrefix(key.RestoreName(), key.Name()) {
+		t.Fatal("expected", true, "got", false)
+	}
+	if key.RestoreName() == key.Name() {
+		t.Fatal("expected", false, "got", true)
+	}
+}
@@ -0,0 +1,134 @@
+package context
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"strconv"
+)
+
+// KeyringConfig represents the configuration used to create a new keyring.
+type KeyringConfig struct {
+	// Settings.
+
+	// KeyID identifies the key within Keys used to encrypt context values.
+	KeyID string
+	// Keys maps key IDs to AES keys of 16, 24 or 32 bytes used to encrypt and
+	// decrypt context values. Keys can be rotated by first adding a new key to
+	// all authorized processes, then encrypting using the new key and finally
+	// removing the old key once no context encrypted using it is in flight.
+	Keys map[string][]byte
+}
+
+// DefaultKeyringConfig provides a default configuration to create a new
+// keyring by best effort.
+func DefaultKeyringConfig() KeyringConfig {
+	newConfig := KeyringConfig{
+		// Settings.
+		KeyID: "",
+		Keys:  nil,
+	}
+
+	return newConfig
+}
+
+// NewKeyring creates a new configured keyring object.
+func NewKeyring(config KeyringConfig) (*Keyring, error) {
+	// Settings.
+	if len(config.Keys) == 0 {
+		return nil, maskAnyf(invalidConfigError, "keys must not be empty")
+	}
+	if _, ok := config.Keys[config.KeyID]; !ok {
+		return nil, maskAnyf(invalidConfigError, "key ID %q must be part of keys", config.KeyID)
+	}
+
+	aeads := map[string]cipher.AEAD{}
+	for id, key := range config.Keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, maskAnyf(invalidConfigError, "key %q: %s", id, err.Error())
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		aeads[id] = aead
+	}
+
+	newKeyring := &Keyring{
+		// Internals.
+		aeads: aeads,
+
+		// Settings.
+		keyID: config.KeyID,
+	}
+
+	return newKeyring, nil
+}
+
+// Keyring encrypts and decrypts the context values of confidential keys using
+// AES-GCM. See RegisterConfidential.
+type Keyring struct {
+	// Internals.
+	aeads map[string]cipher.AEAD
+
+	// Settings.
+	keyID string
+}
+
+// open decrypts the given sealed value of the given key and returns the JSON
+// representation of the context value.
+func (k *Keyring) open(key string, s sealedValue) ([]byte, error) {
+	aead, ok := k.aeads[s.KeyID]
+	if !ok {
+		return nil, maskAnyf(invalidValueError, "key %s: unknown key ID %q", key, s.KeyID)
+	}
+	if len(s.Nonce) != aead.NonceSize() {
+		return nil, maskAnyf(invalidValueError, "key %s: invalid nonce", key)
+	}
+
+	b, err := aead.Open(nil, s.Nonce, s.Ciphertext, sealedData(key, s.Version))
+	if err != nil {
+		return nil, maskAnyf(invalidValueError, "key %s: %s", key, err.Error())
+	}
+
+	return b, nil
+}
+
+// seal encrypts the given JSON representation of the context value of the
+// given key being of the given version.
+func (k *Keyring) seal(key string, version int, b []byte) (sealedValue, error) {
+	aead := k.aeads[k.keyID]
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return sealedValue{}, maskAny(err)
+	}
+
+	s := sealedValue{
+		Ciphertext: aead.Seal(nil, nonce, b, sealedData(key, version)),
+		KeyID:      k.keyID,
+		Nonce:      nonce,
+		Version:    version,
+	}
+
+	return s, nil
+}
+
+// sealedValue is the encrypted representation of a context value of a
+// confidential key. Contexts store sealed values as they were received until
+// they are accessed by a process having the required key.
+type sealedValue struct {
+	Ciphertext []byte `json:"ciphertext"`
+	KeyID      string `json:"key_id"`
+	Nonce      []byte `json:"nonce"`
+	Version    int    `json:"version"`
+}
+
+// sealedData returns the additional data authenticated along with sealed
+// values, so that sealed values cannot be moved to other keys or versions.
+func sealedData(key string, version int) []byte {
+	return []byte(key + "\x00" + strconv.Itoa(version))
+}
@@ -0,0 +1,295 @@
+package context
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+)
+
+type testConfidentialValue struct {
+	Session string `json:"session"`
+}
+
+var testConfidentialKey = MustNewKey(KeyConfig[testConfidentialValue]{
+	Confidential: true,
+	Name:         "github.com/the-anna-project/context/test/confidential",
+})
+
+func testNewAESKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return key
+}
+
+func testNewKeyring(t *testing.T, keyID string, keys map[string][]byte) *Keyring {
+	config := DefaultKeyringConfig()
+	config.KeyID = keyID
+	config.Keys = keys
+	newKeyring, err := NewKeyring(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return newKeyring
+}
+
+func testNewKeyringContext(t *testing.T, keyring *Keyring) Context {
+	config := DefaultConfig()
+	config.Keyring = keyring
+	ctx, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return ctx
+}
+
+func Test_Keyring_Confidential(t *testing.T) {
+	keyring := testNewKeyring(t, "one", map[string][]byte{"one": testNewAESKey(t)})
+	expected := testConfidentialValue{Session: "secret-session"}
+
+	for _, codec := range []Codec{NewJSONCodec(), NewBinaryCodec()} {
+		ctx := testNewKeyringContext(t, keyring)
+		testConfidentialKey.NewContext(ctx, expected)
+		ctx.Create("public", "public")
+
+		// The current process reads its own confidential values in plain text.
+		val, ok := testConfidentialKey.FromContext(ctx)
+		if !ok || val != expected {
+			t.Fatal("expected", expected, "got", val)
+		}
+
+		b, err := codec.Encode(ctx)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		if bytes.Contains(b, []byte("secret-session")) {
+			t.Fatal("expected", false, "got", true)
+		}
+
+		// Intermediate consumers not having the key cannot read confidential
+		// values, but pass them on.
+		intermediate := testNewKeyringContext(t, nil)
+		err = codec.Decode(intermediate, b)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		if _, ok := testConfidentialKey.FromContext(intermediate); ok {
+			t.Fatal("expected", false, "got", true)
+		}
+		if intermediate.Search("public") != "public" {
+			t.Fatal("expected", "public", "got", intermediate.Search("public"))
+		}
+		if intermediate.Len() != 2 {
+			t.Fatal("expected", 2, "got", intermediate.Len())
+		}
+		intermediate.Range(func(key string, value interface{}) bool {
+			if key == testConfidentialKey.Name() && value != nil {
+				t.Fatal("expected", nil, "got", value)
+			}
+			return true
+		})
+		clone, err := intermediate.Clone()
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		b, err = codec.Encode(clone)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+
+		// Authorized workers decrypt confidential values on access.
+		worker := testNewKeyringContext(t, keyring)
+		err = codec.Decode(worker, b)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		val, ok = testConfidentialKey.FromContext(worker)
+		if !ok || val != expected {
+			t.Fatal("expected", expected, "got", val)
+		}
+		if Freeze(worker).Search(testConfidentialKey.Name()) != expected {
+			t.Fatal("expected", expected, "got", Freeze(worker).Search(testConfidentialKey.Name()))
+		}
+	}
+}
+
+func Test_Keyring_NoKeyring(t *testing.T) {
+	ctx := testNewKeyringContext(t, nil)
+	testConfidentialKey.NewContext(ctx, testConfidentialValue{Session: "secret-session"})
+
+	// Confidential values are never encoded in plain text.
+	for _, codec := range []Codec{NewJSONCodec(), NewBinaryCodec(), NewCanonicalCodec()} {
+		_, err := codec.Encode(ctx)
+		if !IsInvalidExecution(err) {
+			t.Fatal("expected", true, "got", false)
+		}
+	}
+}
+
+func Test_Keyring_Rotation(t *testing.T) {
+	one := testNewAESKey(t)
+	two := testNewAESKey(t)
+	expected := testConfidentialValue{Session: "secret-session"}
+
+	ctx := testNewKeyringContext(t, testNewKeyring(t, "one", map[string][]byte{"one": one}))
+	testConfidentialKey.NewContext(ctx, expected)
+	b, err := ctx.MarshalJSON()
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	// Workers knowing the old and the new key decrypt values encrypted using the
+	// old key and encrypt them again using the new key.
+	rotated := testNewKeyringContext(t, testNewKeyring(t, "two", map[string][]byte{"one": one, "two": two}))
+	err = rotated.UnmarshalJSON(b)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	val, _ := testConfidentialKey.FromContext(rotated)
+	if val != expected {
+		t.Fatal("expected", expected, "got", val)
+	}
+	b, err = rotated.MarshalJSON()
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	// Workers which only know the new key read values passed on by rotated
+	// workers.
+	removed := testNewKeyringContext(t, testNewKeyring(t, "two", map[string][]byte{"two": two}))
+	err = removed.UnmarshalJSON(b)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	val, _ = testConfidentialKey.FromContext(removed)
+	if val != expected {
+		t.Fatal("expected", expected, "got", val)
+	}
+}
+
+func Test_Keyring_Tampered(t *testing.T) {
+	keyring := testNewKeyring(t, "one", map[string][]byte{"one": testNewAESKey(t)})
+
+	ctx := testNewKeyringContext(t, keyring)
+	testConfidentialKey.NewContext(ctx, testConfidentialValue{Session: "secret-session"})
+	b, err := ctx.MarshalJSON()
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	var w wire
+	err = json.Unmarshal(b, &w)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	sv := w.Sealed[testConfidentialKey.Name()]
+
+	modified := sv
+	modified.Ciphertext = append([]byte(nil), sv.Ciphertext...)
+	modified.Ciphertext[0] ^= 1
+
+	downgraded := sv
+	downgraded.Version = 1
+
+	testCases := []struct {
+		Key    string
+		Sealed sealedValue
+	}{
+		// Case 1, a modified ciphertext.
+		{
+			Key:    testConfidentialKey.Name(),
+			Sealed: modified,
+		},
+		// Case 2, a sealed value moved to another key.
+		{
+			Key:    "github.com/the-anna-project/context/test/other",
+			Sealed: sv,
+		},
+		// Case 3, a modified version.
+		{
+			Key:    testConfidentialKey.Name(),
+			Sealed: downgraded,
+		},
+	}
+
+	for i, testCase := range testCases {
+		w.Sealed = map[string]sealedValue{testCase.Key: testCase.Sealed}
+		b, err := json.Marshal(w)
+		if err != nil {
+			t.Fatal("case", i+1, "expected", nil, "got", err)
+		}
+
+		other := testNewKeyringContext(t, keyring)
+		err = other.UnmarshalJSON(b)
+		if err != nil {
+			t.Fatal("case", i+1, "expected", nil, "got", err)
+		}
+		if other.Search(testCase.Key) != nil {
+			t.Fatal("case", i+1, "expected", nil, "got", other.Search(testCase.Key))
+		}
+	}
+}
+
+func Test_Keyring_Forged(t *testing.T) {
+	keyring := testNewKeyring(t, "one", map[string][]byte{"one": testNewAESKey(t)})
+
+	// The forged key has the same length as the confidential key, so that it can
+	// be replaced within the binary encoding.
+	forged := "github.com/the-anna-project/context/test/confidentiaX"
+	ctx := testNewContext(t)
+	ctx.Create(forged, testConfidentialValue{Session: "forged-session"})
+
+	for i, codec := range []Codec{NewJSONCodec(), NewBinaryCodec()} {
+		b, err := codec.Encode(ctx)
+		if err != nil {
+			t.Fatal("case", i+1, "expected", nil, "got", err)
+		}
+		b = bytes.Replace(b, []byte(forged), []byte(testConfidentialKey.Name()), 1)
+
+		// Plaintext context values of confidential keys are rejected.
+		other := testNewKeyringContext(t, keyring)
+		err = codec.Decode(other, b)
+		if !IsInvalidValue(err) {
+			t.Fatal("case", i+1, "expected", true, "got", false)
+		}
+		if _, ok := testConfidentialKey.FromContext(other); ok {
+			t.Fatal("case", i+1, "expected", false, "got", true)
+		}
+	}
+}
+
+func Test_NewKeyring_Invalid(t *testing.T) {
+	testCases := []struct {
+		KeyID string
+		Keys  map[string][]byte
+	}{
+		{
+			KeyID: "one",
+			Keys:  nil,
+		},
+		{
+			KeyID: "two",
+			Keys:  map[string][]byte{"one": make([]byte, 32)},
+		},
+		{
+			KeyID: "one",
+			Keys:  map[string][]byte{"one": make([]byte, 7)},
+		},
+	}
+
+	for i, testCase := range testCases {
+		config := DefaultKeyringConfig()
+		config.KeyID = testCase.KeyID
+		config.Keys = testCase.Keys
+		_, err := NewKeyring(config)
+		if !IsInvalidConfig(err) {
+			t.Fatal("case", i+1, "expected", true, "got", false)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package context
+
+// maxDepth bounds the nesting depth of context values even if Limits.MaxDepth
+// is disabled, so that hostile input cannot exhaust the stack. It equals the
+// nesting limit of encoding/json.
+const maxDepth = 10000
+
+// Limits bounds the encoded contexts being decoded by UnmarshalJSON and codecs.
+// Decoding fails with an error which can be asserted using IsLimitExceeded in
+// case any limit is exceeded. A zero value disables the respective limit.
+type Limits struct {
+	// MaxBytes is the maximum size of an encoded context in bytes.
+	MaxBytes int
+	// MaxDepth is the maximum nesting depth of a single encoded context value.
+	// Scalars have a depth of 0, lists and objects of scalars have a depth of 1.
+	MaxDepth int
+	// MaxKeys is the maximum number of context values of an encoded context.
+	MaxKeys int
+	// MaxValueBytes is the maximum size of a single encoded context value in
+	// bytes.
+	MaxValueBytes int
+}
+
+// DefaultLimits provides the limits used by DefaultConfig, which are generous
+// enough for all contexts this repository produces.
+func DefaultLimits() Limits {
+	newLimits := Limits{
+		MaxBytes:      4 << 20,
+		MaxDepth:      64,
+		MaxKeys:       10000,
+		MaxValueBytes: 1 << 20,
+	}
+
+	return newLimits
+}
+
+func (l Limits) checkBytes(n int) error {
+	if l.MaxBytes > 0 && n > l.MaxBytes {
+		return maskAnyf(limitExceededError, "%d bytes exceed maximum of %d bytes", n, l.MaxBytes)
+	}
+
+	return nil
+}
+
+func (l Limits) checkKeys(n int) error {
+	if l.MaxKeys > 0 && n > l.MaxKeys {
+		return maskAnyf(limitExceededError, "%d keys exceed maximum of %d keys", n, l.MaxKeys)
+	}
+
+	return nil
+}
+
+// checkValue checks the size and nesting depth of the given JSON encoded
+// context value of the given key.
+func (l Limits) checkValue(key string, raw []byte) error {
+	err := l.checkValueBytes(key, len(raw))
+	if err != nil {
+		return maskAny(err)
+	}
+	if d := jsonDepth(raw); d > l.depth() {
+		return maskAnyf(limitExceededError, "key %s: depth %d exceeds maximum of %d", key, d, l.depth())
+	}
+
+	return nil
+}
+
+func (l Limits) checkValueBytes(key string, n int) error {
+	if l.MaxValueBytes > 0 && n > l.MaxValueBytes {
+		return maskAnyf(limitExceededError, "key %s: %d bytes exceed maximum of %d bytes", key, n, l.MaxValueBytes)
+	}
+
+	return nil
+}
+
+// depth returns the effective maximum nesting depth of context values.
+func (l Limits) depth() int {
+	if l.MaxDepth > 0 && l.MaxDepth < maxDepth {
+		return l.MaxDepth
+	}
+
+	return maxDepth
+}
+
+// jsonDepth returns the maximum nesting depth of the given JSON document
+// without parsing it. Invalid documents are reported by the actual parser.
+func jsonDepth(b []byte) int {
+	var depth, max int
+	var inString, escaped bool
+
+	for _, c := range b {
+		if inString {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '[', '{':
+			depth++
+			if depth > max {
+				max = depth
+			}
+		case ']', '}':
+			depth--
+		}
+	}
+
+	return max
+}
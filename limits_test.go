@@ -0,0 +1,218 @@
+package context
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_Limits(t *testing.T) {
+	nested := func(depth int) interface{} {
+		var v interface{} = "leaf"
+		for i := 0; i < depth; i++ {
+			v = []interface{}{v}
+		}
+		return v
+	}
+
+	testCases := []struct {
+		Limits       Limits
+		Values       map[string]interface{}
+		ErrorMatcher func(err error) bool
+	}{
+		// Case 1, the default limits accept ordinary contexts.
+		{
+			Limits:       DefaultLimits(),
+			Values:       map[string]interface{}{"foo": "bar", "list": nested(3)},
+			ErrorMatcher: nil,
+		},
+		// Case 2, disabled limits accept everything.
+		{
+			Limits:       Limits{},
+			Values:       map[string]interface{}{"foo": strings.Repeat("a", 1000), "list": nested(100)},
+			ErrorMatcher: nil,
+		},
+		// Case 3, too many bytes.
+		{
+			Limits:       Limits{MaxBytes: 100},
+			Values:       map[string]interface{}{"foo": strings.Repeat("a", 1000)},
+			ErrorMatcher: IsLimitExceeded,
+		},
+		// Case 4, too many keys.
+		{
+			Limits:       Limits{MaxKeys: 2},
+			Values:       map[string]interface{}{"a": 1, "b": 2, "c": 3},
+			ErrorMatcher: IsLimitExceeded,
+		},
+		// Case 5, a value nested exactly as deep as allowed.
+		{
+			Limits:       Limits{MaxDepth: 5},
+			Values:       map[string]interface{}{"list": nested(5)},
+			ErrorMatcher: nil,
+		},
+		// Case 6, a value nested too deep.
+		{
+			Limits:       Limits{MaxDepth: 5},
+			Values:       map[string]interface{}{"list": nested(6)},
+			ErrorMatcher: IsLimitExceeded,
+		},
+		// Case 7, a value being too large.
+		{
+			Limits:       Limits{MaxValueBytes: 100},
+			Values:       map[string]interface{}{"foo": "bar", "large": strings.Repeat("a", 1000)},
+			ErrorMatcher: IsLimitExceeded,
+		},
+	}
+
+	for i, testCase := range testCases {
+		for _, codec := range []Codec{NewJSONCodec(), NewBinaryCodec()} {
+			ctx, err := New(DefaultConfig())
+			if err != nil {
+				t.Fatal("case", i+1, "expected", nil, "got", err)
+			}
+			for k, v := range testCase.Values {
+				ctx.Create(k, v)
+			}
+			b, err := codec.Encode(ctx)
+			if err != nil {
+				t.Fatal("case", i+1, "expected", nil, "got", err)
+			}
+
+			config := DefaultConfig()
+			config.Limits = testCase.Limits
+			other, err := New(config)
+			if err != nil {
+				t.Fatal("case", i+1, "expected", nil, "got", err)
+			}
+			err = codec.Decode(other, b)
+			if testCase.ErrorMatcher == nil {
+				if err != nil {
+					t.Fatal("case", i+1, "expected", nil, "got", err)
+				}
+				if other.Len() != len(testCase.Values) {
+					t.Fatal("case", i+1, "expected", len(testCase.Values), "got", other.Len())
+				}
+			} else {
+				if !testCase.ErrorMatcher(err) {
+					t.Fatal("case", i+1, "expected", true, "got", false)
+				}
+				// Nothing is merged into contexts in case decoding fails.
+				if other.Len() != 0 {
+					t.Fatal("case", i+1, "expected", 0, "got", other.Len())
+				}
+			}
+		}
+	}
+}
+
+func Test_Limits_Clone(t *testing.T) {
+	config := DefaultConfig()
+	config.Limits = Limits{MaxKeys: 1}
+	ctx, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	clone, err := ctx.Clone()
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	err = clone.UnmarshalJSON([]byte(`{"storage":{"a":1,"b":2}}`))
+	if !IsLimitExceeded(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+	err = Namespace(clone, "ns").UnmarshalJSON([]byte(`{"storage":{"a":1,"b":2}}`))
+	if !IsLimitExceeded(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+}
+
+func Test_Limits_HardDepth(t *testing.T) {
+	// Even without limits hostile nesting must not exhaust the stack.
+	config := DefaultConfig()
+	config.Limits = Limits{}
+	ctx, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	deep := strings.Repeat("[", maxDepth+1) + strings.Repeat("]", maxDepth+1)
+	err = ctx.UnmarshalJSON([]byte(`{"storage":{"deep":` + deep + `}}`))
+	if !IsLimitExceeded(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+
+	b := []byte("actx\x01\x00\x00\x01\x04deep\x00")
+	for i := 0; i < maxDepth+1; i++ {
+		b = append(b, binaryValueList, 1)
+	}
+	b = append(b, binaryValueNil)
+	err = NewBinaryCodec().Decode(ctx, b)
+	if !IsLimitExceeded(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+}
+
+func FuzzUnmarshalJSON(f *testing.F) {
+	seeds := []string{
+		`{}`,
+		`{"storage":{"foo":"bar","n":1.5,"l":[1,{"a":null}]}}`,
+		`{"canceled":true,"deadline":"2017-01-01T00:00:00Z","error":"context canceled","storage":{}}`,
+		`{"storage":{"k":1},"version":1,"versions":{"k":3}}`,
+		`{"storage":{"k":[[[[[[[[[[]]]]]]]]]]}}`,
+		`{"storage":{"k":"\"]]]]"}}`,
+		`{"version":-1}`,
+		`[`,
+	}
+	for _, s := range seeds {
+		f.Add([]byte(s))
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		config := DefaultConfig()
+		config.Limits = Limits{MaxBytes: 1 << 16, MaxDepth: 16, MaxKeys: 64, MaxValueBytes: 1 << 12}
+		ctx, err := New(config)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		defer ctx.Cancel()
+
+		// Errors are fine, panics are not.
+		ctx.UnmarshalJSON(b)
+	})
+}
+
+func FuzzBinaryCodec(f *testing.F) {
+	codec := NewBinaryCodec()
+	for i := 0; i < 3; i++ {
+		ctx, err := New(DefaultConfig())
+		if err != nil {
+			f.Fatal("expected", nil, "got", err)
+		}
+		for j := 0; j < i; j++ {
+			ctx.Create(fmt.Sprintf("key-%d", j), map[string]interface{}{"list": []interface{}{j, "a", nil, true}})
+		}
+		ctx.Create("github.com/the-anna-project/context/test", testValue{IDs: []string{"a"}, Name: "name"})
+		if i == 2 {
+			ctx.Cancel()
+		}
+		b, err := codec.Encode(ctx)
+		if err != nil {
+			f.Fatal("expected", nil, "got", err)
+		}
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		config := DefaultConfig()
+		config.Limits = Limits{MaxBytes: 1 << 16, MaxDepth: 16, MaxKeys: 64, MaxValueBytes: 1 << 12}
+		ctx, err := New(config)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		defer ctx.Cancel()
+
+		// Errors are fine, panics are not.
+		codec.Decode(ctx, b)
+	})
+}
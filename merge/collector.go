@@ -0,0 +1,238 @@
+package merge
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/the-anna-project/context"
+	currentclgtree "github.com/the-anna-project/context/current/clg/tree"
+	currentcorrelation "github.com/the-anna-project/context/current/correlation"
+	currentsession "github.com/the-anna-project/context/current/session"
+)
+
+// CollectorConfig represents the configuration used to create a new collector.
+type CollectorConfig struct {
+	// Settings.
+
+	// Correlate returns the correlation of the given context. Contexts sharing
+	// the same correlation are merged together.
+	Correlate func(ctx context.Context) (string, error)
+	// Options are the options used to merge the contexts of a correlation. See
+	// NewContextFromContexts.
+	Options []Option
+	// Size is the number of contexts expected for each correlation.
+	Size int
+	// Timeout is the duration after the arrival of the first context of a
+	// correlation after which the contexts of the correlation are merged, even
+	// though less contexts than expected arrived. A zero timeout waits forever.
+	Timeout time.Duration
+}
+
+// DefaultCollectorConfig provides a default configuration to create a new
+// collector by best effort.
+func DefaultCollectorConfig() CollectorConfig {
+	newConfig := CollectorConfig{
+		// Settings.
+		Correlate: Correlate,
+		Options:   nil,
+		Size:      0,
+		Timeout:   0,
+	}
+
+	return newConfig
+}
+
+// NewCollector creates a new configured collector object.
+func NewCollector(config CollectorConfig) (Collector, error) {
+	// Settings.
+	if config.Correlate == nil {
+		return nil, maskAnyf(invalidConfigError, "correlate must not be empty")
+	}
+	if config.Size <= 0 {
+		return nil, maskAnyf(invalidConfigError, "size must be greater than 0")
+	}
+	if config.Timeout < 0 {
+		return nil, maskAnyf(invalidConfigError, "timeout must not be negative")
+	}
+
+	newCollector := &collector{
+		// Internals.
+		closed:       false,
+		correlations: map[string]*correlation{},
+		mutex:        sync.Mutex{},
+		results:      make(chan Result),
+		waitGroup:    sync.WaitGroup{},
+
+		// Settings.
+		correlate: config.Correlate,
+		options:   config.Options,
+		size:      config.Size,
+		timeout:   config.Timeout,
+	}
+
+	return newCollector, nil
+}
+
+// Correlate returns the correlation of the given context based on the IDs of
+// the current CLG tree, the current session and the current correlation, if
+// any. It is the default correlation of collectors.
+func Correlate(ctx context.Context) (string, error) {
+	tree, treeOK := currentclgtree.FromContext(ctx)
+	session, sessionOK := currentsession.FromContext(ctx)
+
+	if !treeOK && !sessionOK {
+		return "", maskAnyf(invalidExecutionError, "context must carry a CLG tree or session")
+	}
+
+	correlation, ok := currentcorrelation.FromContext(ctx)
+	if ok {
+		return correlationKey(tree.ID, session.ID, correlation.ID), nil
+	}
+
+	return correlationKey(tree.ID, session.ID), nil
+}
+
+// correlationKey joins the given IDs to a single correlation. Each ID is
+// prefixed by its length, so that IDs containing any character cannot collide,
+// e.g. "4:tree7:session".
+func correlationKey(ids ...string) string {
+	var key string
+	for _, id := range ids {
+		key += fmt.Sprintf("%d:%s", len(id), id)
+	}
+
+	return key
+}
+
+type collector struct {
+	// Internals.
+	closed       bool
+	correlations map[string]*correlation
+	mutex        sync.Mutex
+	results      chan Result
+	waitGroup    sync.WaitGroup
+
+	// Settings.
+	correlate func(ctx context.Context) (string, error)
+	options   []Option
+	size      int
+	timeout   time.Duration
+}
+
+// correlation holds the contexts of a single correlation collected so far.
+type correlation struct {
+	ctxs  []context.Context
+	timer *time.Timer
+}
+
+func (c *collector) Add(ctx context.Context) error {
+	id, err := c.correlate(ctx)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	c.mutex.Lock()
+
+	if c.closed {
+		c.mutex.Unlock()
+		return maskAnyf(invalidExecutionError, "collector must not be closed")
+	}
+
+	cor, ok := c.correlations[id]
+	if !ok {
+		cor = &correlation{}
+		if c.timeout > 0 {
+			cor.timer = time.AfterFunc(c.timeout, func() {
+				c.expire(id, cor)
+			})
+		}
+		c.correlations[id] = cor
+	}
+	cor.ctxs = append(cor.ctxs, ctx)
+
+	if len(cor.ctxs) < c.size {
+		c.mutex.Unlock()
+		return nil
+	}
+
+	if cor.timer != nil {
+		cor.timer.Stop()
+	}
+	delete(c.correlations, id)
+	c.waitGroup.Add(1)
+	c.mutex.Unlock()
+
+	// The producing worker must not wait for the consumer of the results.
+	go c.emit(id, cor.ctxs, false)
+
+	return nil
+}
+
+func (c *collector) Close() {
+	c.mutex.Lock()
+
+	if c.closed {
+		c.mutex.Unlock()
+		return
+	}
+	c.closed = true
+
+	pending := c.correlations
+	c.correlations = map[string]*correlation{}
+	for _, cor := range pending {
+		if cor.timer != nil {
+			cor.timer.Stop()
+		}
+	}
+	c.waitGroup.Add(len(pending))
+	c.mutex.Unlock()
+
+	for id, cor := range pending {
+		go c.emit(id, cor.ctxs, true)
+	}
+
+	c.waitGroup.Wait()
+	close(c.results)
+}
+
+func (c *collector) Results() <-chan Result {
+	return c.results
+}
+
+// emit merges the given contexts and sends the result. emit must only be called
+// after adding to the wait group.
+func (c *collector) emit(id string, ctxs []context.Context, partial bool) {
+	defer c.waitGroup.Done()
+
+	r := Result{
+		Correlation: id,
+		Count:       len(ctxs),
+		Partial:     partial,
+	}
+
+	ctx, err := context.New(context.DefaultConfig())
+	if err != nil {
+		r.Error = maskAny(err)
+	} else {
+		r.Context, r.Error = NewContextFromContexts(ctx, ctxs, c.options...)
+	}
+
+	c.results <- r
+}
+
+// expire emits the contexts of the given correlation as partial join, unless
+// the correlation was already emitted.
+func (c *collector) expire(id string, cor *correlation) {
+	c.mutex.Lock()
+
+	if c.correlations[id] != cor {
+		c.mutex.Unlock()
+		return
+	}
+	delete(c.correlations, id)
+	c.waitGroup.Add(1)
+	c.mutex.Unlock()
+
+	c.emit(id, cor.ctxs, true)
+}
@@ -0,0 +1,272 @@
+package merge
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/the-anna-project/context"
+	currentclgtree "github.com/the-anna-project/context/current/clg/tree"
+	currentcorrelation "github.com/the-anna-project/context/current/correlation"
+	currentsession "github.com/the-anna-project/context/current/session"
+)
+
+func Test_Collector_New(t *testing.T) {
+	testCases := []struct {
+		Config       func() CollectorConfig
+		ErrorMatcher func(err error) bool
+	}{
+		{
+			Config: func() CollectorConfig {
+				return DefaultCollectorConfig()
+			},
+			ErrorMatcher: IsInvalidConfig,
+		},
+		{
+			Config: func() CollectorConfig {
+				config := DefaultCollectorConfig()
+				config.Size = 3
+				config.Correlate = nil
+				return config
+			},
+			ErrorMatcher: IsInvalidConfig,
+		},
+		{
+			Config: func() CollectorConfig {
+				config := DefaultCollectorConfig()
+				config.Size = 3
+				config.Timeout = -time.Second
+				return config
+			},
+			ErrorMatcher: IsInvalidConfig,
+		},
+		{
+			Config: func() CollectorConfig {
+				config := DefaultCollectorConfig()
+				config.Size = 3
+				return config
+			},
+			ErrorMatcher: nil,
+		},
+	}
+
+	for i, testCase := range testCases {
+		_, err := NewCollector(testCase.Config())
+		if (err != nil && testCase.ErrorMatcher == nil) || (testCase.ErrorMatcher != nil && !testCase.ErrorMatcher(err)) {
+			t.Fatal("case", i+1, "expected", true, "got", false)
+		}
+	}
+}
+
+func Test_Collector_Complete(t *testing.T) {
+	collector := testNewCollector(t, 3, 0)
+
+	var wg sync.WaitGroup
+	for _, session := range []string{"one", "two"} {
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(session string) {
+				defer wg.Done()
+
+				err := collector.Add(testNewCorrelatedContext(t, "tree", session))
+				if err != nil {
+					t.Error("expected", nil, "got", err)
+				}
+			}(session)
+		}
+	}
+
+	results := map[string]Result{}
+	for i := 0; i < 2; i++ {
+		r := <-collector.Results()
+		results[r.Correlation] = r
+	}
+	wg.Wait()
+
+	for _, correlation := range []string{"4:tree3:one", "4:tree3:two"} {
+		r, ok := results[correlation]
+		if !ok {
+			t.Fatal("expected", true, "got", false)
+		}
+		if r.Error != nil {
+			t.Fatal("expected", nil, "got", r.Error)
+		}
+		if r.Partial {
+			t.Fatal("expected", false, "got", true)
+		}
+		if r.Count != 3 {
+			t.Fatal("expected", 3, "got", r.Count)
+		}
+		tree, ok := currentclgtree.FromContext(r.Context)
+		if !ok {
+			t.Fatal("expected", true, "got", false)
+		}
+		if tree.ID != "tree" {
+			t.Fatal("expected", "tree", "got", tree.ID)
+		}
+	}
+}
+
+func Test_Collector_SlowConsumer(t *testing.T) {
+	collector := testNewCollector(t, 1, 0)
+
+	// Completing correlations does not block the producing worker, even though
+	// nobody receives the results yet.
+	done := make(chan struct{})
+	go func() {
+		for _, session := range []string{"one", "two", "three"} {
+			err := collector.Add(testNewCorrelatedContext(t, "tree", session))
+			if err != nil {
+				t.Error("expected", nil, "got", err)
+			}
+		}
+		close(done)
+	}()
+
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("expected", "done", "got", "timeout")
+	case <-done:
+	}
+
+	for i := 0; i < 3; i++ {
+		r := <-collector.Results()
+		if r.Error != nil {
+			t.Fatal("expected", nil, "got", r.Error)
+		}
+	}
+}
+
+func Test_Collector_Timeout(t *testing.T) {
+	collector := testNewCollector(t, 3, 5*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		err := collector.Add(testNewCorrelatedContext(t, "tree", "session"))
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+	}
+
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("expected", "result", "got", "timeout")
+	case r := <-collector.Results():
+		if !r.Partial {
+			t.Fatal("expected", true, "got", false)
+		}
+		if r.Count != 2 {
+			t.Fatal("expected", 2, "got", r.Count)
+		}
+		if r.Error != nil {
+			t.Fatal("expected", nil, "got", r.Error)
+		}
+	}
+}
+
+func Test_Collector_Close(t *testing.T) {
+	collector := testNewCollector(t, 3, 0)
+
+	err := collector.Add(testNewCorrelatedContext(t, "tree", "session"))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		collector.Close()
+		close(done)
+	}()
+
+	r, ok := <-collector.Results()
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if !r.Partial {
+		t.Fatal("expected", true, "got", false)
+	}
+	if r.Count != 1 {
+		t.Fatal("expected", 1, "got", r.Count)
+	}
+
+	_, ok = <-collector.Results()
+	if ok {
+		t.Fatal("expected", false, "got", true)
+	}
+	<-done
+
+	err = collector.Add(testNewCorrelatedContext(t, "tree", "session"))
+	if !IsInvalidExecution(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+}
+
+func Test_Collector_Correlate(t *testing.T) {
+	collector := testNewCollector(t, 3, 0)
+
+	err := collector.Add(testNewContext(t))
+	if !IsInvalidExecution(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+}
+
+func Test_Correlate(t *testing.T) {
+	ctx := testNewCorrelatedContext(t, "tree", "session")
+
+	correlation, err := Correlate(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if correlation != "4:tree7:session" {
+		t.Fatal("expected", "4:tree7:session", "got", correlation)
+	}
+
+	// Contexts created by a split carry a correlation ID, which distinguishes
+	// them from other contexts of the same CLG tree and session.
+	ctx = currentcorrelation.NewContext(ctx, currentcorrelation.Value{ID: "id"})
+
+	correlation, err = Correlate(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if correlation != "4:tree7:session2:id" {
+		t.Fatal("expected", "4:tree7:session2:id", "got", correlation)
+	}
+
+	// IDs containing separators do not cause different contexts to share a
+	// correlation.
+	a, err := Correlate(testNewCorrelatedContext(t, "a/b", "c"))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	b, err := Correlate(testNewCorrelatedContext(t, "a", "b/c"))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	c, err := Correlate(currentcorrelation.NewContext(testNewCorrelatedContext(t, "a", "b"), currentcorrelation.Value{ID: "c"}))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if a == b || a == c || b == c {
+		t.Fatal("expected", "distinct correlations", "got", a, b, c)
+	}
+}
+
+func testNewCollector(t *testing.T, size int, timeout time.Duration) Collector {
+	config := DefaultCollectorConfig()
+	config.Size = size
+	config.Timeout = timeout
+	collector, err := NewCollector(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return collector
+}
+
+func testNewCorrelatedContext(t *testing.T, tree, session string) context.Context {
+	ctx := testNewContext(t)
+	ctx = currentclgtree.NewContext(ctx, currentclgtree.Value{ID: tree})
+	ctx = currentsession.NewContext(ctx, currentsession.Value{ID: session})
+
+	return ctx
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"github.com/juju/errgo"
+
+	"github.com/the-anna-project/context"
 )
 
 var (
@@ -28,3 +30,33 @@ var invalidConfigError = errgo.New("invalid config")
 func IsInvalidConfig(err error) bool {
 	return errgo.Cause(err) == invalidConfigError
 }
+
+var invalidExecutionError = errgo.New("invalid execution")
+
+// IsInvalidExecution asserts invalidExecutionError. It also asserts invalid
+// execution errors of the merge functions of the packages of this repository.
+func IsInvalidExecution(err error) bool {
+	return errgo.Cause(err) == invalidExecutionError || context.IsInvalidExecution(err)
+}
+
+var readOnlyError = errgo.New("read only")
+
+// IsReadOnly asserts readOnlyError. It also asserts read only errors of the
+// packages of this repository.
+func IsReadOnly(err error) bool {
+	return errgo.Cause(err) == readOnlyError || context.IsReadOnly(err)
+}
+
+// ConflictError describes context values which cannot be merged. See
+// github.com/the-anna-project/context.ConflictError.
+type ConflictError = context.ConflictError
+
+// IsConflict asserts ConflictError.
+func IsConflict(err error) bool {
+	return context.IsConflict(err)
+}
+
+// ConflictFromError returns the ConflictError causing err, if any.
+func ConflictFromError(err error) (*ConflictError, bool) {
+	return context.ConflictFromError(err)
+}
@@ -3,9 +3,15 @@
 package merge
 
 import (
+	nativecontext "context"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/the-anna-project/context"
 	currentbehaviour "github.com/the-anna-project/context/current/behaviour"
 	currentclgtree "github.com/the-anna-project/context/current/clg/tree"
+	currentcorrelation "github.com/the-anna-project/context/current/correlation"
 	currentdestination "github.com/the-anna-project/context/current/destination"
 	currentexpectation "github.com/the-anna-project/context/current/expectation"
 	currentsession "github.com/the-anna-project/context/current/session"
@@ -15,33 +21,278 @@ import (
 	firstinformation "github.com/the-anna-project/context/first/information"
 )
 
+func init() {
+	RegisterKey(currentbehaviour.Key)
+	RegisterKey(currentclgtree.Key)
+	Register(currentcorrelation.Key.Name(), currentcorrelation.NewContextFromContexts)
+	RegisterKey(currentdestination.Key)
+	RegisterKey(currentexpectation.Key)
+	RegisterKey(currentsession.Key)
+	RegisterKey(currentsource.Key)
+	RegisterKey(currentstage.Key)
+	RegisterKey(firstbehaviour.Key)
+	RegisterKey(firstinformation.Key)
+}
+
 // NewContextFromContexts creates a new context from the given list of contexts.
-// Therefore all information transported by all the given contexts have to be
-// equal, but the following ones.
+// Therefore all merge functions added using Register are executed. The merge
+// functions of the packages of this repository are registered by default. All
+// information transported by all the given contexts have to be equal, but the
+// following ones.
 //
 //     current/source
 //
-func NewContextFromContexts(ctx context.Context, ctxs []context.Context) (context.Context, error) {
+// Merging the contexts of a split closes their correlation, so that the merged
+// context carries the correlation of the context being split, if any. See
+// github.com/the-anna-project/context/current/correlation.
+//
+// The merge of single keys can be customized by providing strategies using
+// WithStrategy.
+//
+//     ctx, err := merge.NewContextFromContexts(ctx, ctxs, merge.WithStrategy(destination.Key.Name(), merge.LastWins))
+//
+// By default contexts not carrying a context value for a key conflict with
+// contexts carrying one, except for the keys listed above. WithMissing
+// configures merges of partial information, where missing context values are
+// ignored. In case no context carries a context value for a key, no context
+// value is stored.
+//
+// Context values stored using keys not being registered are dropped, unless a
+// strategy for such keys is provided using WithUnknownKeys.
+//
+// The merged context can be bound to the cancelation and deadlines of the
+// given list of contexts using WithCancelation and WithEarliestDeadline, so that
+// a join never outlives the work it merges.
+//
+// Merging into a frozen context fails with an error which can be asserted
+// using IsReadOnly. See github.com/the-anna-project/context.Freeze.
+//
+// In case context values conflict, the returned error is caused by a
+// ConflictError describing the conflict.
+//
+//     conflict, ok := merge.ConflictFromError(err)
+//
+func NewContextFromContexts(ctx context.Context, ctxs []context.Context, options ...Option) (context.Context, error) {
+	if context.IsFrozen(ctx) {
+		return nil, maskAnyf(readOnlyError, "cannot merge into frozen context")
+	}
+
 	var err error
 
-	modifiers := []func(ctx context.Context, ctxs []context.Context) (context.Context, error){
-		currentbehaviour.NewContextFromContexts,
-		currentclgtree.NewContextFromContexts,
-		currentdestination.NewContextFromContexts,
-		currentexpectation.NewContextFromContexts,
-		currentsession.NewContextFromContexts,
-		currentsource.NewContextFromContexts,
-		currentstage.NewContextFromContexts,
-		firstbehaviour.NewContextFromContexts,
-		firstinformation.NewContextFromContexts,
+	c := newConfig(options)
+	names, funcs := registered()
+
+	for i, n := range names {
+		f := funcs[i]
+		if s, ok := c.Strategies[n]; ok {
+			f = strategyFunc(n, s)
+		}
+
+		ctx, err = newContextFromKey(ctx, ctxs, n, f, c.Missing)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	}
+
+	for _, n := range sortedKeys(c.Strategies) {
+		if contains(names, n) {
+			continue
+		}
+
+		ctx, err = newContextFromKey(ctx, ctxs, n, strategyFunc(n, c.Strategies[n]), c.Missing)
+		if err != nil {
+			return nil, maskAny(err)
+		}
 	}
 
-	for _, m := range modifiers {
-		ctx, err = m(ctx, ctxs)
+	if c.Unknown != nil {
+		for _, n := range unknownKeys(ctxs, names, c.Strategies) {
+			ctx, err = newContextFromKey(ctx, ctxs, n, strategyFunc(n, c.Unknown), c.Missing)
+			if err != nil {
+				return nil, maskAny(err)
+			}
+		}
+	}
+
+	if c.EarliestDeadline {
+		ctx, err = newContextFromDeadlines(ctx, ctxs)
 		if err != nil {
 			return nil, maskAny(err)
 		}
 	}
 
+	newContextFromCancelation(ctx, ctxs, c.Cancelation)
+
 	return ctx, nil
 }
+
+// newContextFromCancelation cancels the given context on cancelation of the
+// given list of contexts as defined by the given cancelation.
+func newContextFromCancelation(ctx context.Context, ctxs []context.Context, cancelation Cancelation) {
+	if cancelation == CancelNever || len(ctxs) == 0 {
+		return
+	}
+
+	var mutex sync.Mutex
+	remaining := len(ctxs)
+
+	var stopFuncs []func() bool
+	for _, c := range ctxs {
+		stop := nativecontext.AfterFunc(c, func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			remaining--
+			if cancelation == CancelOnAny || remaining == 0 {
+				ctx.Cancel()
+			}
+		})
+		stopFuncs = append(stopFuncs, stop)
+	}
+
+	// Once the merged context is done there is no need to watch the given list
+	// of contexts anymore.
+	nativecontext.AfterFunc(ctx, func() {
+		for _, stop := range stopFuncs {
+			stop()
+		}
+	})
+}
+
+// newContextFromDeadlines returns a clone of the given context using the
+// earliest deadline of the given list of contexts, if any.
+func newContextFromDeadlines(ctx context.Context, ctxs []context.Context) (context.Context, error) {
+	var earliest time.Time
+	for _, c := range ctxs {
+		d, ok := c.Deadline()
+		if ok && (earliest.IsZero() || d.Before(earliest)) {
+			earliest = d
+		}
+	}
+
+	if earliest.IsZero() {
+		return ctx, nil
+	}
+
+	newContext, err := context.WithDeadline(ctx, earliest)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return newContext, nil
+}
+
+// newContextFromKey merges the context values stored using the given key
+// within the given list of contexts into the given context using the given
+// merge function. Contexts not carrying any context value for the key are
+// handled as defined by the given missing mode.
+func newContextFromKey(ctx context.Context, ctxs []context.Context, key string, f Func, missing Missing) (context.Context, error) {
+	var indexes []int
+	var present []context.Context
+	for i, c := range ctxs {
+		if c.Search(key) != nil {
+			indexes = append(indexes, i)
+			present = append(present, c)
+		}
+	}
+
+	// Zero values are never written on behalf of absent information.
+	if len(present) == 0 {
+		return ctx, nil
+	}
+	if missing == MissingPass {
+		return f(ctx, ctxs)
+	}
+
+	if missing == MissingConflict && len(present) != len(ctxs) {
+		conflict := &ConflictError{
+			Key:    key,
+			Reason: "context values must be present in all contexts",
+		}
+		for i, c := range ctxs {
+			conflict.Indexes = append(conflict.Indexes, i)
+			conflict.Values = append(conflict.Values, c.Search(key))
+		}
+		return nil, maskAny(conflict)
+	}
+
+	ctx, err := f(ctx, present)
+	if conflict, ok := ConflictFromError(err); ok {
+		// The conflict refers to the list of contexts carrying a context value.
+		// It is translated to refer to the given list of contexts.
+		for i, index := range conflict.Indexes {
+			conflict.Indexes[i] = indexes[index]
+		}
+		return nil, maskAny(conflict)
+	} else if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return ctx, nil
+}
+
+// strategyFunc returns a merge function merging the context values stored
+// using the given key within the given list of contexts into the given context
+// using the given strategy.
+func strategyFunc(key string, s Strategy) Func {
+	return func(ctx context.Context, ctxs []context.Context) (context.Context, error) {
+		var values []interface{}
+		for _, c := range ctxs {
+			values = append(values, c.Search(key))
+		}
+
+		v, err := s(values)
+		if conflict, ok := ConflictFromError(err); ok {
+			conflict.Key = key
+			return nil, maskAny(conflict)
+		} else if err != nil {
+			return nil, maskAnyf(err, "key %s", key)
+		}
+		if v != nil {
+			ctx.Create(key, v)
+		}
+
+		return ctx, nil
+	}
+}
+
+// unknownKeys returns the sorted list of keys stored within any of the given
+// contexts, which are neither registered nor covered by any of the given
+// strategies.
+func unknownKeys(ctxs []context.Context, names []string, strategies map[string]Strategy) []string {
+	var keys []string
+	for _, c := range ctxs {
+		for _, k := range c.Keys() {
+			if contains(keys, k) || contains(names, k) {
+				continue
+			}
+			if _, ok := strategies[k]; ok {
+				continue
+			}
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func contains(list []string, item string) bool {
+	for _, l := range list {
+		if l == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(m map[string]Strategy) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
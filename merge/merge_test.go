@@ -0,0 +1,370 @@
+package merge
+
+import (
+	nativecontext "context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/the-anna-project/context"
+	currentbehaviour "github.com/the-anna-project/context/current/behaviour"
+	currentsession "github.com/the-anna-project/context/current/session"
+	currentsource "github.com/the-anna-project/context/current/source"
+)
+
+type testValue struct {
+	ID string `json:"id"`
+}
+
+func Test_NewContextFromContexts(t *testing.T) {
+	ctxs := testNewContexts(t)
+	for i, c := range ctxs {
+		currentbehaviour.NewContext(c, currentbehaviour.Value{ID: "id"})
+		currentsource.NewContext(c, currentsource.Value{IDs: []string{string(rune('a' + i))}})
+	}
+
+	ctx, err := NewContextFromContexts(testNewContext(t), ctxs)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	behaviour, ok := currentbehaviour.FromContext(ctx)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if behaviour.ID != "id" {
+		t.Fatal("expected", "id", "got", behaviour.ID)
+	}
+	source, ok := currentsource.FromContext(ctx)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if len(source.IDs) != 3 {
+		t.Fatal("expected", 3, "got", len(source.IDs))
+	}
+
+	// Different values of packages requiring equal values cause the merge to
+	// fail.
+	currentbehaviour.NewContext(ctxs[1], currentbehaviour.Value{ID: "other"})
+	_, err = NewContextFromContexts(testNewContext(t), ctxs)
+	if !context.IsInvalidExecution(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+
+	// The conflict should be described in detail.
+	conflict, ok := ConflictFromError(err)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if conflict.Key != currentbehaviour.Key.Name() {
+		t.Fatal("expected", currentbehaviour.Key.Name(), "got", conflict.Key)
+	}
+	if !reflect.DeepEqual(conflict.Indexes, []int{0, 1}) {
+		t.Fatal("expected", []int{0, 1}, "got", conflict.Indexes)
+	}
+	if conflict.Values[1].(currentbehaviour.Value).ID != "other" {
+		t.Fatal("expected", "other", "got", conflict.Values[1])
+	}
+}
+
+func Test_NewContextFromContexts_Cancelation(t *testing.T) {
+	testCases := []struct {
+		Cancelation Cancelation
+		Cancel      int
+		Expected    bool
+	}{
+		{
+			Cancelation: CancelNever,
+			Cancel:      3,
+			Expected:    false,
+		},
+		{
+			Cancelation: CancelOnAny,
+			Cancel:      0,
+			Expected:    false,
+		},
+		{
+			Cancelation: CancelOnAny,
+			Cancel:      1,
+			Expected:    true,
+		},
+		{
+			Cancelation: CancelOnAll,
+			Cancel:      2,
+			Expected:    false,
+		},
+		{
+			Cancelation: CancelOnAll,
+			Cancel:      3,
+			Expected:    true,
+		},
+	}
+
+	for i, testCase := range testCases {
+		ctxs := testNewContexts(t)
+		ctx, err := NewContextFromContexts(testNewContext(t), ctxs, WithCancelation(testCase.Cancelation))
+		if err != nil {
+			t.Fatal("case", i+1, "expected", nil, "got", err)
+		}
+
+		for _, c := range ctxs[:testCase.Cancel] {
+			c.Cancel()
+		}
+
+		select {
+		case <-time.After(5 * time.Millisecond):
+			if testCase.Expected {
+				t.Fatal("case", i+1, "expected", "cancel", "got", "timeout")
+			}
+		case <-ctx.Done():
+			if !testCase.Expected {
+				t.Fatal("case", i+1, "expected", "timeout", "got", "cancel")
+			}
+		}
+	}
+}
+
+func Test_NewContextFromContexts_EarliestDeadline(t *testing.T) {
+	earliest := time.Now().Add(time.Hour)
+
+	var ctxs []context.Context
+	for _, d := range []time.Time{earliest.Add(time.Minute), earliest, {}} {
+		config := context.DefaultConfig()
+		if !d.IsZero() {
+			nativeCtx, cancelFunc := nativecontext.WithDeadline(nativecontext.Background(), d)
+			defer cancelFunc()
+			config.Context = nativeCtx
+		}
+		ctx, err := context.New(config)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		ctxs = append(ctxs, ctx)
+	}
+
+	ctx := testNewContext(t)
+	ctx.Create("foo", "bar")
+
+	merged, err := NewContextFromContexts(ctx, ctxs, WithEarliestDeadline())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	d, ok := merged.Deadline()
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if !d.Equal(earliest) {
+		t.Fatal("expected", earliest, "got", d)
+	}
+	if merged.Search("foo") != "bar" {
+		t.Fatal("expected", "bar", "got", merged.Search("foo"))
+	}
+
+	// Without any deadline the merged context has no deadline.
+	merged, err = NewContextFromContexts(testNewContext(t), testNewContexts(t), WithEarliestDeadline())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	_, ok = merged.Deadline()
+	if ok {
+		t.Fatal("expected", false, "got", true)
+	}
+}
+
+func Test_NewContextFromContexts_WithMissing(t *testing.T) {
+	ctxs := testNewContexts(t)
+	currentbehaviour.NewContext(ctxs[0], currentbehaviour.Value{ID: "id"})
+	currentbehaviour.NewContext(ctxs[2], currentbehaviour.Value{ID: "id"})
+
+	// Missing values conflict with the given value by default. They are
+	// reported as nil, not as zero values.
+	_, err := NewContextFromContexts(testNewContext(t), ctxs)
+	conflict, ok := ConflictFromError(err)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if !reflect.DeepEqual(conflict.Indexes, []int{0, 1}) {
+		t.Fatal("expected", []int{0, 1}, "got", conflict.Indexes)
+	}
+	if conflict.Values[1] != nil {
+		t.Fatal("expected", nil, "got", conflict.Values[1])
+	}
+
+	// Values no context carries are not written by default either.
+	ctx, err := NewContextFromContexts(testNewContext(t), nil)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if len(ctx.Keys()) != 0 {
+		t.Fatal("expected", 0, "got", len(ctx.Keys()))
+	}
+
+	// Missing values can be ignored.
+	ctx, err = NewContextFromContexts(testNewContext(t), ctxs, WithMissing(MissingIgnore))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	behaviour, ok := currentbehaviour.FromContext(ctx)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if behaviour.ID != "id" {
+		t.Fatal("expected", "id", "got", behaviour.ID)
+	}
+
+	// Values no context carries are not written when ignoring missing values.
+	_, ok = currentsession.FromContext(ctx)
+	if ok {
+		t.Fatal("expected", false, "got", true)
+	}
+	ctx, err = NewContextFromContexts(testNewContext(t), nil, WithMissing(MissingIgnore))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if len(ctx.Keys()) != 0 {
+		t.Fatal("expected", 0, "got", len(ctx.Keys()))
+	}
+
+	// Missing values can be required to be present in all contexts.
+	_, err = NewContextFromContexts(testNewContext(t), ctxs, WithMissing(MissingConflict))
+	conflict, ok = ConflictFromError(err)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if !reflect.DeepEqual(conflict.Indexes, []int{0, 1, 2}) {
+		t.Fatal("expected", []int{0, 1, 2}, "got", conflict.Indexes)
+	}
+	if conflict.Values[1] != nil {
+		t.Fatal("expected", nil, "got", conflict.Values[1])
+	}
+
+	// Zero values being present are not missing. Conflicts refer to the indexes
+	// of the given contexts.
+	currentbehaviour.NewContext(ctxs[2], currentbehaviour.Value{})
+	_, err = NewContextFromContexts(testNewContext(t), ctxs, WithMissing(MissingIgnore))
+	conflict, ok = ConflictFromError(err)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if !reflect.DeepEqual(conflict.Indexes, []int{0, 2}) {
+		t.Fatal("expected", []int{0, 2}, "got", conflict.Indexes)
+	}
+}
+
+func Test_NewContextFromContexts_Frozen(t *testing.T) {
+	ctxs := testNewContexts(t)
+	for _, c := range ctxs {
+		currentbehaviour.NewContext(c, currentbehaviour.Value{ID: "id"})
+	}
+
+	_, err := NewContextFromContexts(context.Freeze(testNewContext(t)), ctxs)
+	if !IsReadOnly(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+
+	// Frozen contexts can be merged into other contexts.
+	for i, c := range ctxs {
+		ctxs[i] = context.Freeze(c)
+	}
+	_, err = NewContextFromContexts(testNewContext(t), ctxs)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+}
+
+// The test merge functions are registered once, because the registry is global
+// to the process and tests may run multiple times, e.g. using go test -count.
+var (
+	testRegisterCalled int64
+	testRegisterKey    = context.MustNewKey(context.KeyConfig[testValue]{
+		Name: "github.com/the-anna-project/context/merge/test/register",
+	})
+)
+
+func init() {
+	RegisterKey(testRegisterKey)
+	Register("github.com/the-anna-project/context/merge/test/func", func(ctx context.Context, ctxs []context.Context) (context.Context, error) {
+		atomic.AddInt64(&testRegisterCalled, 1)
+		return ctx, nil
+	})
+}
+
+func Test_Register(t *testing.T) {
+	key := testRegisterKey
+	atomic.StoreInt64(&testRegisterCalled, 0)
+
+	// Merge functions are not executed unless any context carries a context
+	// value stored using their name.
+	_, err := NewContextFromContexts(testNewContext(t), testNewContexts(t))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if atomic.LoadInt64(&testRegisterCalled) != 0 {
+		t.Fatal("expected", 0, "got", atomic.LoadInt64(&testRegisterCalled))
+	}
+
+	ctxs := testNewContexts(t)
+	for _, c := range ctxs {
+		key.NewContext(c, testValue{ID: "id"})
+	}
+	ctxs[0].Create("github.com/the-anna-project/context/merge/test/func", "value")
+
+	ctx, err := NewContextFromContexts(testNewContext(t), ctxs)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	val, ok := key.FromContext(ctx)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if val.ID != "id" {
+		t.Fatal("expected", "id", "got", val.ID)
+	}
+	if atomic.LoadInt64(&testRegisterCalled) != 1 {
+		t.Fatal("expected", 1, "got", atomic.LoadInt64(&testRegisterCalled))
+	}
+
+	// Registered values are validated as well.
+	key.NewContext(ctxs[0], testValue{ID: "other"})
+	_, err = NewContextFromContexts(testNewContext(t), ctxs)
+	if !context.IsInvalidExecution(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+}
+
+func Test_Register_Twice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected", "panic", "got", nil)
+		}
+	}()
+
+	RegisterKey(currentbehaviour.Key)
+}
+
+func testNewContext(t *testing.T) context.Context {
+	var ctx context.Context
+	{
+		var err error
+		ctx, err = context.New(context.DefaultConfig())
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+	}
+
+	return ctx
+}
+
+func testNewContexts(t *testing.T) []context.Context {
+	var ctxs []context.Context
+	{
+		for i := 0; i < 3; i++ {
+			ctx := testNewContext(t)
+			ctxs = append(ctxs, ctx)
+		}
+	}
+
+	return ctxs
+}
@@ -0,0 +1,116 @@
+package merge
+
+// Cancelation defines whether the merged context is canceled on cancelation of
+// the contexts being merged.
+type Cancelation int
+
+const (
+	// CancelNever does not cancel the merged context on cancelation of the
+	// contexts being merged. This is the default.
+	CancelNever Cancelation = iota
+	// CancelOnAny cancels the merged context as soon as any of the contexts
+	// being merged is canceled.
+	CancelOnAny
+	// CancelOnAll cancels the merged context as soon as all of the contexts
+	// being merged are canceled.
+	CancelOnAll
+)
+
+// Missing defines how contexts not carrying a context value for a key are
+// treated when merging the context values of this key.
+type Missing int
+
+const (
+	// MissingPass passes all contexts to the merge function of a key. The merge
+	// functions of the packages of this repository require missing context
+	// values to be missing in all contexts. Strategies receive nil for missing
+	// context values. In case no context carries a context value for a key, no
+	// context value is stored within the merged context. This is the default.
+	MissingPass Missing = iota
+	// MissingIgnore only merges the context values of contexts carrying a
+	// context value for a key. In case no context carries a context value for a
+	// key, no context value is stored within the merged context.
+	MissingIgnore
+	// MissingConflict requires a context value for a key to be carried by either
+	// all or none of the contexts. In case no context carries a context value
+	// for a key, no context value is stored within the merged context.
+	MissingConflict
+)
+
+// Option configures the merge executed by NewContextFromContexts.
+type Option func(c *config)
+
+// config represents the configuration of a single merge.
+type config struct {
+	// Settings.
+	Cancelation      Cancelation
+	EarliestDeadline bool
+	Missing          Missing
+	Strategies       map[string]Strategy
+	Unknown          Strategy
+}
+
+// newConfig creates the configuration of a single merge by applying the given
+// options.
+func newConfig(options []Option) config {
+	newConfig := config{
+		// Settings.
+		Cancelation:      CancelNever,
+		EarliestDeadline: false,
+		Missing:          MissingPass,
+		Strategies:       map[string]Strategy{},
+		Unknown:          nil,
+	}
+
+	for _, o := range options {
+		o(&newConfig)
+	}
+
+	return newConfig
+}
+
+// WithCancelation links the cancelation of the merged context to the
+// cancelation of the contexts being merged as defined by the given cancelation.
+func WithCancelation(cancelation Cancelation) Option {
+	return func(c *config) {
+		c.Cancelation = cancelation
+	}
+}
+
+// WithEarliestDeadline adopts the earliest deadline of the contexts being
+// merged for the merged context. Therefore the merged context is a clone of the
+// given context. See github.com/the-anna-project/context.WithDeadline.
+func WithEarliestDeadline() Option {
+	return func(c *config) {
+		c.EarliestDeadline = true
+	}
+}
+
+// WithMissing defines how contexts not carrying a context value for a key are
+// treated.
+func WithMissing(missing Missing) Option {
+	return func(c *config) {
+		c.Missing = missing
+	}
+}
+
+// WithStrategy merges the context values stored using the given key by the
+// given strategy. The strategy takes precedence over the merge function being
+// registered for the key, if any. Keys without registered merge function are
+// merged as well.
+func WithStrategy(key string, s Strategy) Option {
+	return func(c *config) {
+		c.Strategies[key] = s
+	}
+}
+
+// WithUnknownKeys merges the context values stored using keys without
+// registered merge function and without strategy by the given strategy. By
+// default such context values are dropped. Useful strategies are StrictEqual
+// to require equal context values and FirstWins to keep the first context
+// value.
+func WithUnknownKeys(s Strategy) Option {
+	return func(c *config) {
+		c.Unknown = s
+	}
+}
@@ -0,0 +1,65 @@
+package merge
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/the-anna-project/context"
+)
+
+// Func merges the context values of a list of contexts into a single context.
+// Each package managing context values provides such a function, usually
+// called NewContextFromContexts.
+type Func func(ctx context.Context, ctxs []context.Context) (context.Context, error)
+
+var registry = struct {
+	sync.RWMutex
+	funcs map[string]Func
+}{
+	funcs: map[string]Func{},
+}
+
+// Register adds the given merge function to the list of merge functions being
+// executed by NewContextFromContexts. The name should be the key of the context
+// values the merge function is responsible for. The merge function is only
+// executed in case any context carries a context value stored using the name.
+// Register panics if f is nil or if the name is registered twice.
+func Register(name string, f Func) {
+	if f == nil {
+		panic("merge: Register func is nil")
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.funcs[name]; ok {
+		panic("merge: Register called twice for name " + name)
+	}
+	registry.funcs[name] = f
+}
+
+// RegisterKey registers the merge function of the given key using the key's
+// name.
+func RegisterKey[T any](key *context.Key[T]) {
+	Register(key.Name(), key.NewContextFromContexts)
+}
+
+// registered returns the names and merge functions of the registry, sorted by
+// name to guarantee a deterministic merge order.
+func registered() ([]string, []Func) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	var names []string
+	for n := range registry.funcs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var funcs []Func
+	for _, n := range names {
+		funcs = append(funcs, registry.funcs[n])
+	}
+
+	return names, funcs
+}
@@ -0,0 +1,44 @@
+package merge
+
+import (
+	"github.com/the-anna-project/context"
+)
+
+// Collector collects contexts being delivered one by one, e.g. by different
+// workers of an event queue, and merges them once all contexts belonging
+// together arrived. Contexts belong together when they share the same
+// correlation. A collector is safe for concurrent use by multiple goroutines.
+//
+// A correlation is forgotten once it was merged, including when it timed out.
+// So contexts arriving late start a new correlation, which results in another,
+// usually partial, Result carrying the same Correlation. Consumers must not
+// assume a single Result per correlation.
+type Collector interface {
+	// Add adds the given context to the contexts of its correlation. Add never
+	// waits for the merged context to be received from Results, so that slow
+	// consumers do not stall the workers producing contexts.
+	Add(ctx context.Context) error
+	// Close merges all pending correlations as partial joins and closes the
+	// results channel afterwards. Close blocks until all results are received
+	// from Results.
+	Close()
+	// Results returns the channel of merged contexts.
+	Results() <-chan Result
+}
+
+// Result is the outcome of merging the contexts of a single correlation. Late
+// contexts of a correlation which timed out are merged into further results
+// having the same Correlation. See Collector.
+type Result struct {
+	// Context is the merged context. It is nil in case Error is not nil.
+	Context context.Context
+	// Correlation is the correlation of the merged contexts.
+	Correlation string
+	// Count is the number of contexts being merged.
+	Count int
+	// Error is the error occurred while merging the contexts, if any.
+	Error error
+	// Partial is true in case less contexts than expected were merged, because
+	// the collector timed out or was closed.
+	Partial bool
+}
@@ -0,0 +1,224 @@
+package merge
+
+import (
+	"reflect"
+)
+
+// Strategy reduces the context values of a single key found within a list of
+// contexts to the context value being stored within the merged context. The
+// value at index i is the value stored within the context at index i. Contexts
+// not carrying any value are represented by nil. A strategy returning nil does
+// not store any value within the merged context.
+type Strategy func(values []interface{}) (interface{}, error)
+
+// StrictEqual requires all context values to be equal. Contexts not carrying
+// any value only equal other contexts not carrying any value.
+func StrictEqual(values []interface{}) (interface{}, error) {
+	var reference interface{}
+
+	conflict := &ConflictError{
+		Reason: "context values must be equal",
+	}
+	for i, v := range values {
+		if i == 0 {
+			reference = v
+		}
+		if !equal(v, reference) {
+			conflict.Indexes = append(conflict.Indexes, i)
+			conflict.Values = append(conflict.Values, v)
+		}
+	}
+	if len(conflict.Indexes) != 0 {
+		conflict.Indexes = append([]int{0}, conflict.Indexes...)
+		conflict.Values = append([]interface{}{reference}, conflict.Values...)
+		return nil, maskAny(conflict)
+	}
+
+	return reference, nil
+}
+
+// FirstWins uses the context value of the first context carrying one.
+func FirstWins(values []interface{}) (interface{}, error) {
+	for _, v := range values {
+		if v != nil {
+			return v, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// LastWins uses the context value of the last context carrying one.
+func LastWins(values []interface{}) (interface{}, error) {
+	for i := len(values) - 1; i >= 0; i-- {
+		if values[i] != nil {
+			return values[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Union combines the context values of all contexts carrying one. Values
+// being slices result in a slice containing each distinct element once, in
+// order of appearance. Values being structs are combined field by field, where
+// fields being slices are combined like described above and all other fields
+// have to be equal. All values have to be of the same type.
+func Union(values []interface{}) (interface{}, error) {
+	var result reflect.Value
+	var index int
+
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+
+		rv := reflect.ValueOf(v)
+		first := !result.IsValid()
+		if first {
+			result = reflect.New(rv.Type()).Elem()
+			index = i
+		}
+		if rv.Type() != result.Type() {
+			return nil, maskAny(&ConflictError{
+				Indexes: []int{index, i},
+				Reason:  "context values must be of the same type",
+				Values:  []interface{}{values[index], v},
+			})
+		}
+
+		err := union(result, rv, first)
+		if IsConflict(err) {
+			return nil, maskAny(&ConflictError{
+				Indexes: []int{index, i},
+				Reason:  "context values must be equal except for slices",
+				Values:  []interface{}{values[index], v},
+			})
+		} else if err != nil {
+			return nil, maskAny(err)
+		}
+	}
+
+	if !result.IsValid() {
+		return nil, nil
+	}
+
+	return result.Interface(), nil
+}
+
+// Majority uses the context value carried by most of the contexts. Contexts
+// not carrying any value do not vote. In case there is no single value carried
+// most often, the merge fails.
+func Majority(values []interface{}) (interface{}, error) {
+	var candidates []interface{}
+	var votes []int
+
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+
+		found := false
+		for i, c := range candidates {
+			if equal(v, c) {
+				votes[i]++
+				found = true
+				break
+			}
+		}
+		if !found {
+			candidates = append(candidates, v)
+			votes = append(votes, 1)
+		}
+	}
+
+	var winner interface{}
+	var max int
+	var tie bool
+	for i, c := range candidates {
+		if votes[i] > max {
+			winner = c
+			max = votes[i]
+			tie = false
+		} else if votes[i] == max {
+			tie = true
+		}
+	}
+
+	if tie {
+		conflict := &ConflictError{
+			Reason: "context values must have a majority",
+		}
+		for i, v := range values {
+			if v != nil {
+				conflict.Indexes = append(conflict.Indexes, i)
+				conflict.Values = append(conflict.Values, v)
+			}
+		}
+		return nil, maskAny(conflict)
+	}
+
+	return winner, nil
+}
+
+// equal checks whether the given context values are equal. Values providing an
+// Equals method, like the values of the packages of this repository, are
+// compared using this method. All other values are compared using
+// reflect.DeepEqual.
+func equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	m := reflect.ValueOf(a).MethodByName("Equals")
+	if m.IsValid() {
+		t := m.Type()
+		bv := reflect.ValueOf(b)
+		if t.NumIn() == 1 && t.NumOut() == 1 && t.Out(0).Kind() == reflect.Bool && bv.Type().AssignableTo(t.In(0)) {
+			return m.Call([]reflect.Value{bv})[0].Bool()
+		}
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// union adds the distinct elements of v to result. In case first is true, v is
+// the first value being added to result. See Union.
+func union(result, v reflect.Value, first bool) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			e := v.Index(i)
+
+			found := false
+			for j := 0; j < result.Len(); j++ {
+				if reflect.DeepEqual(result.Index(j).Interface(), e.Interface()) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				result.Set(reflect.Append(result, e))
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !result.Field(i).CanSet() {
+				return maskAnyf(invalidExecutionError, "context values must only have exported fields")
+			}
+
+			err := union(result.Field(i), v.Field(i), first)
+			if err != nil {
+				return maskAny(err)
+			}
+		}
+	default:
+		if first {
+			result.Set(v)
+		} else if !reflect.DeepEqual(result.Interface(), v.Interface()) {
+			return maskAny(&ConflictError{})
+		}
+	}
+
+	return nil
+}
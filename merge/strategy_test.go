@@ -0,0 +1,255 @@
+package merge
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/the-anna-project/context"
+	currentdestination "github.com/the-anna-project/context/current/destination"
+	currentsource "github.com/the-anna-project/context/current/source"
+)
+
+func Test_Strategy(t *testing.T) {
+	testCases := []struct {
+		Strategy     Strategy
+		Values       []interface{}
+		ErrorMatcher func(err error) bool
+		Expected     interface{}
+	}{
+		// StrictEqual requires all values to be equal.
+		{
+			Strategy:     StrictEqual,
+			Values:       []interface{}{"a", "a", "a"},
+			ErrorMatcher: nil,
+			Expected:     "a",
+		},
+		{
+			Strategy:     StrictEqual,
+			Values:       []interface{}{"a", "b", "a"},
+			ErrorMatcher: IsInvalidExecution,
+			Expected:     nil,
+		},
+		{
+			Strategy:     StrictEqual,
+			Values:       []interface{}{"a", nil, "a"},
+			ErrorMatcher: IsInvalidExecution,
+			Expected:     nil,
+		},
+		{
+			Strategy:     StrictEqual,
+			Values:       []interface{}{nil, nil},
+			ErrorMatcher: nil,
+			Expected:     nil,
+		},
+		// StrictEqual uses the Equals method of values.
+		{
+			Strategy: StrictEqual,
+			Values: []interface{}{
+				currentdestination.Value{ID: "id"},
+				currentdestination.Value{ID: "id"},
+			},
+			ErrorMatcher: nil,
+			Expected:     currentdestination.Value{ID: "id"},
+		},
+		// FirstWins and LastWins ignore missing values.
+		{
+			Strategy:     FirstWins,
+			Values:       []interface{}{nil, "a", "b"},
+			ErrorMatcher: nil,
+			Expected:     "a",
+		},
+		{
+			Strategy:     LastWins,
+			Values:       []interface{}{"a", "b", nil},
+			ErrorMatcher: nil,
+			Expected:     "b",
+		},
+		{
+			Strategy:     FirstWins,
+			Values:       []interface{}{nil, nil},
+			ErrorMatcher: nil,
+			Expected:     nil,
+		},
+		// Union combines slices.
+		{
+			Strategy:     Union,
+			Values:       []interface{}{[]string{"a", "b"}, nil, []string{"b", "c"}},
+			ErrorMatcher: nil,
+			Expected:     []string{"a", "b", "c"},
+		},
+		// Union combines the slice fields of structs.
+		{
+			Strategy: Union,
+			Values: []interface{}{
+				currentsource.Value{IDs: []string{"a"}, Names: []string{"x"}},
+				currentsource.Value{IDs: []string{"a", "b"}, Names: []string{"y"}},
+			},
+			ErrorMatcher: nil,
+			Expected:     currentsource.Value{IDs: []string{"a", "b"}, Names: []string{"x", "y"}},
+		},
+		// Union requires other fields of structs to be equal.
+		{
+			Strategy: Union,
+			Values: []interface{}{
+				currentdestination.Value{ID: "a"},
+				currentdestination.Value{ID: "b"},
+			},
+			ErrorMatcher: IsInvalidExecution,
+			Expected:     nil,
+		},
+		{
+			Strategy:     Union,
+			Values:       []interface{}{[]string{"a"}, "b"},
+			ErrorMatcher: IsConflict,
+			Expected:     nil,
+		},
+		// Majority uses the value most contexts carry.
+		{
+			Strategy:     Majority,
+			Values:       []interface{}{"a", "b", "b", nil, nil},
+			ErrorMatcher: nil,
+			Expected:     "b",
+		},
+		{
+			Strategy:     Majority,
+			Values:       []interface{}{"a", "b", "b", "a"},
+			ErrorMatcher: IsInvalidExecution,
+			Expected:     nil,
+		},
+		{
+			Strategy:     Majority,
+			Values:       []interface{}{nil},
+			ErrorMatcher: nil,
+			Expected:     nil,
+		},
+	}
+
+	for i, testCase := range testCases {
+		v, err := testCase.Strategy(testCase.Values)
+		if (err != nil && testCase.ErrorMatcher == nil) || (testCase.ErrorMatcher != nil && !testCase.ErrorMatcher(err)) {
+			t.Fatal("case", i+1, "expected", true, "got", false)
+		}
+		if !reflect.DeepEqual(v, testCase.Expected) {
+			t.Fatal("case", i+1, "expected", testCase.Expected, "got", v)
+		}
+	}
+}
+
+func Test_NewContextFromContexts_WithStrategy(t *testing.T) {
+	ctxs := testNewContexts(t)
+	for i, c := range ctxs {
+		currentdestination.NewContext(c, currentdestination.Value{ID: string(rune('a' + i))})
+		c.Create("github.com/the-anna-project/context/merge/test/strategy", i)
+	}
+
+	// Different destinations cause the merge to fail by default.
+	_, err := NewContextFromContexts(testNewContext(t), ctxs)
+	if !IsInvalidExecution(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+
+	// Conflicts of strategies should be described in detail.
+	_, err = NewContextFromContexts(
+		testNewContext(t),
+		ctxs,
+		WithStrategy(currentdestination.Key.Name(), LastWins),
+		WithStrategy("github.com/the-anna-project/context/merge/test/strategy", Majority),
+	)
+	conflict, ok := ConflictFromError(err)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if conflict.Key != "github.com/the-anna-project/context/merge/test/strategy" {
+		t.Fatal("expected", "github.com/the-anna-project/context/merge/test/strategy", "got", conflict.Key)
+	}
+	if !reflect.DeepEqual(conflict.Indexes, []int{0, 1, 2}) {
+		t.Fatal("expected", []int{0, 1, 2}, "got", conflict.Indexes)
+	}
+	if !reflect.DeepEqual(conflict.Values, []interface{}{0, 1, 2}) {
+		t.Fatal("expected", []interface{}{0, 1, 2}, "got", conflict.Values)
+	}
+
+	var ctx context.Context
+	ctx, err = NewContextFromContexts(
+		testNewContext(t),
+		ctxs,
+		WithStrategy(currentdestination.Key.Name(), LastWins),
+		WithStrategy("github.com/the-anna-project/context/merge/test/strategy", FirstWins),
+	)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	destination, ok := currentdestination.FromContext(ctx)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if destination.ID != "c" {
+		t.Fatal("expected", "c", "got", destination.ID)
+	}
+	v := ctx.Search("github.com/the-anna-project/context/merge/test/strategy")
+	if v != 0 {
+		t.Fatal("expected", 0, "got", v)
+	}
+}
+
+func Test_NewContextFromContexts_WithUnknownKeys(t *testing.T) {
+	ctxs := testNewContexts(t)
+	for i, c := range ctxs {
+		c.Create("github.com/the-anna-project/context/merge/test/unknown/equal", "equal")
+		c.Create("github.com/the-anna-project/context/merge/test/unknown/index", i)
+	}
+	ctxs[1].Create("github.com/the-anna-project/context/merge/test/unknown/partial", "partial")
+
+	// Unknown keys are dropped by default.
+	ctx, err := NewContextFromContexts(testNewContext(t), ctxs)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	for _, k := range ctx.Keys() {
+		if strings.HasPrefix(k, "github.com/the-anna-project/context/merge/test/unknown") {
+			t.Fatal("expected", "dropped", "got", k)
+		}
+	}
+
+	// Requiring equal values fails for differing and partial values.
+	_, err = NewContextFromContexts(testNewContext(t), ctxs, WithUnknownKeys(StrictEqual))
+	conflict, ok := ConflictFromError(err)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if conflict.Key != "github.com/the-anna-project/context/merge/test/unknown/index" {
+		t.Fatal("expected", "github.com/the-anna-project/context/merge/test/unknown/index", "got", conflict.Key)
+	}
+
+	// Strategies for explicit keys take precedence.
+	ctx, err = NewContextFromContexts(
+		testNewContext(t),
+		ctxs,
+		WithUnknownKeys(StrictEqual),
+		WithStrategy("github.com/the-anna-project/context/merge/test/unknown/index", LastWins),
+		WithStrategy("github.com/the-anna-project/context/merge/test/unknown/partial", FirstWins),
+	)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if ctx.Search("github.com/the-anna-project/context/merge/test/unknown/equal") != "equal" {
+		t.Fatal("expected", "equal", "got", ctx.Search("github.com/the-anna-project/context/merge/test/unknown/equal"))
+	}
+	if ctx.Search("github.com/the-anna-project/context/merge/test/unknown/index") != 2 {
+		t.Fatal("expected", 2, "got", ctx.Search("github.com/the-anna-project/context/merge/test/unknown/index"))
+	}
+
+	// Keeping the first value keeps all unknown keys.
+	ctx, err = NewContextFromContexts(testNewContext(t), ctxs, WithUnknownKeys(FirstWins))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if ctx.Search("github.com/the-anna-project/context/merge/test/unknown/index") != 0 {
+		t.Fatal("expected", 0, "got", ctx.Search("github.com/the-anna-project/context/merge/test/unknown/index"))
+	}
+	if ctx.Search("github.com/the-anna-project/context/merge/test/unknown/partial") != "partial" {
+		t.Fatal("expected", "partial", "got", ctx.Search("github.com/the-anna-project/context/merge/test/unknown/partial"))
+	}
+}
@@ -0,0 +1,116 @@
+package context
+
+// WireVersion is the version of the JSON representation of contexts produced
+// by MarshalJSON. Representations without version, produced before versioning
+// was introduced, are treated as version 0, which has the same layout as
+// version 1. UnmarshalJSON rejects representations of newer versions.
+const WireVersion = 1
+
+// MigrationFunc converts the JSON representation of a context value from one
+// version to another.
+type MigrationFunc func(b []byte) ([]byte, error)
+
+// Migration describes how the JSON representation of a context value is
+// converted between two consecutive versions. Upgrade converts a context value
+// from the older to the newer version. Downgrade converts a context value from
+// the newer to the older version.
+type Migration struct {
+	Downgrade MigrationFunc
+	Upgrade   MigrationFunc
+}
+
+// RegisterMigrations associates the given key with the given migrations.
+// migrations[i] converts version i to version i+1 and back. version is the
+// version of the context values produced by the current process. MarshalJSON
+// encodes this version along with each context value. UnmarshalJSON upgrades
+// context values of older versions and downgrades context values of newer
+// versions to this version. That is why migrations up to version require an
+// upgrade and all further migrations require a downgrade. The latter allow to
+// roll out processes which understand a new version before processes start to
+// produce it. Context values of unregistered keys have version 0.
+// RegisterMigrations panics if the migrations are invalid or if the key is
+// registered twice.
+func RegisterMigrations(key string, version int, migrations ...Migration) {
+	err := validateMigrations(version, migrations)
+	if err != nil {
+		panic("context: RegisterMigrations " + err.Error())
+	}
+
+	err = register(nil, nil, schema{migrations: migrations, version: version}, key)
+	if err != nil {
+		panic("context: RegisterMigrations called twice for key " + key)
+	}
+}
+
+// schema describes the versions of the context values of a single key.
+type schema struct {
+	migrations []Migration
+	version    int
+}
+
+func (s schema) empty() bool {
+	return s.version == 0 && len(s.migrations) == 0
+}
+
+// validateMigrations checks whether the given migrations are able to convert
+// context values of all known versions to the given version.
+func validateMigrations(version int, migrations []Migration) error {
+	if version < 0 {
+		return maskAnyf(invalidConfigError, "version must not be negative")
+	}
+	if version > len(migrations) {
+		return maskAnyf(invalidConfigError, "version must not be greater than the number of migrations")
+	}
+	for i, m := range migrations {
+		if i < version && m.Upgrade == nil {
+			return maskAnyf(invalidConfigError, "migration %d must have an upgrade", i)
+		}
+		if i >= version && m.Downgrade == nil {
+			return maskAnyf(invalidConfigError, "migration %d must have a downgrade", i)
+		}
+	}
+
+	return nil
+}
+
+// valueVersion returns the version of the context values stored using the
+// given key.
+func valueVersion(key string) int {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	return registry.schemas[key].version
+}
+
+// migrateValue converts the JSON representation of the context value stored
+// using the given key from the given version to the version produced by the
+// current process.
+func migrateValue(key string, version int, b []byte) ([]byte, error) {
+	registry.RLock()
+	s := registry.schemas[key]
+	registry.RUnlock()
+
+	if version < 0 {
+		return nil, maskAnyf(versionMismatchError, "key %s: version %d must not be negative", key, version)
+	}
+	if version > len(s.migrations) {
+		return nil, maskAnyf(versionMismatchError, "key %s: version %d is newer than the supported versions up to %d", key, version, len(s.migrations))
+	}
+
+	for v := version; v < s.version; v++ {
+		var err error
+		b, err = s.migrations[v].Upgrade(b)
+		if err != nil {
+			return nil, maskAnyf(invalidValueError, "key %s: upgrade from version %d to %d: %s", key, v, v+1, err.Error())
+		}
+	}
+	for v := version; v > s.version; v-- {
+		var err error
+		b, err = s.migrations[v-1].Downgrade(b)
+		if err != nil {
+			return nil, maskAnyf(invalidValueError, "key %s: downgrade from version %d to %d: %s", key, v, v-1, err.Error())
+		}
+	}
+
+	return b, nil
+}
@@ -0,0 +1,164 @@
+package context
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+type testMigrationValue struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func testMigrationRename(from, to string) MigrationFunc {
+	return func(b []byte) ([]byte, error) {
+		return bytes.Replace(b, []byte(`"`+from+`"`), []byte(`"`+to+`"`), 1), nil
+	}
+}
+
+// The migrations of the test keys are registered once, because the registry is
+// global to the process and tests may run multiple times, e.g. using go test
+// -count.
+//
+// Version 0 of testMigrationKey stored the name as id, version 1 renamed it to
+// name. Version 2 renames type to kind and is not yet produced.
+var testMigrationKey = MustNewKey(KeyConfig[testMigrationValue]{
+	Migrations: []Migration{
+		{
+			Downgrade: testMigrationRename("name", "id"),
+			Upgrade:   testMigrationRename("id", "name"),
+		},
+		{
+			Downgrade: testMigrationRename("kind", "type"),
+		},
+	},
+	Name:    "github.com/the-anna-project/context/test/migration",
+	Version: 1,
+})
+
+func init() {
+	RegisterMigrations("github.com/the-anna-project/context/test/migration/mismatch", 1, Migration{
+		Upgrade: func(b []byte) ([]byte, error) {
+			return b, nil
+		},
+	})
+}
+
+func Test_Migration(t *testing.T) {
+	key := testMigrationKey
+
+	testCases := []struct {
+		JSON     string
+		Expected testMigrationValue
+	}{
+		// Legacy representations without versions.
+		{
+			JSON:     `{"storage":{"github.com/the-anna-project/context/test/migration":{"id":"one","type":"t"}}}`,
+			Expected: testMigrationValue{Name: "one", Type: "t"},
+		},
+		// Current representations.
+		{
+			JSON:     `{"storage":{"github.com/the-anna-project/context/test/migration":{"name":"two","type":"t"}},"version":1,"versions":{"github.com/the-anna-project/context/test/migration":1}}`,
+			Expected: testMigrationValue{Name: "two", Type: "t"},
+		},
+		// Newer representations are downgraded.
+		{
+			JSON:     `{"storage":{"github.com/the-anna-project/context/test/migration":{"name":"three","kind":"t"}},"version":1,"versions":{"github.com/the-anna-project/context/test/migration":2}}`,
+			Expected: testMigrationValue{Name: "three", Type: "t"},
+		},
+	}
+
+	for i, testCase := range testCases {
+		ctx := testNewContext(t)
+		err := json.Unmarshal([]byte(testCase.JSON), ctx)
+		if err != nil {
+			t.Fatal("case", i+1, "expected", nil, "got", err)
+		}
+		val, ok := key.FromContext(ctx)
+		if !ok {
+			t.Fatal("case", i+1, "expected", true, "got", false)
+		}
+		if val != testCase.Expected {
+			t.Fatal("case", i+1, "expected", testCase.Expected, "got", val)
+		}
+	}
+
+	// The current versions are encoded.
+	ctx := key.NewContext(testNewContext(t), testMigrationValue{Name: "name"})
+	b, err := json.Marshal(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	var w wire
+	err = json.Unmarshal(b, &w)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if w.Version != WireVersion {
+		t.Fatal("expected", WireVersion, "got", w.Version)
+	}
+	if w.Versions[key.Name()] != 1 {
+		t.Fatal("expected", 1, "got", w.Versions[key.Name()])
+	}
+	if _, ok := w.Versions["foo"]; ok {
+		t.Fatal("expected", false, "got", true)
+	}
+}
+
+func Test_Migration_Mismatch(t *testing.T) {
+	testCases := []string{
+		`{"storage":{},"version":2}`,
+		`{"storage":{},"version":-1}`,
+		`{"storage":{"github.com/the-anna-project/context/test/migration/mismatch":"val"},"version":1,"versions":{"github.com/the-anna-project/context/test/migration/mismatch":2}}`,
+		`{"storage":{"foo":"val"},"version":1,"versions":{"foo":1}}`,
+	}
+
+	for i, testCase := range testCases {
+		ctx := testNewContext(t)
+		err := json.Unmarshal([]byte(testCase), ctx)
+		if !IsVersionMismatch(err) {
+			t.Fatal("case", i+1, "expected", true, "got", false)
+		}
+	}
+}
+
+func Test_RegisterMigrations_Invalid(t *testing.T) {
+	upgrade := func(b []byte) ([]byte, error) {
+		return b, nil
+	}
+
+	testCases := []struct {
+		Version    int
+		Migrations []Migration
+	}{
+		{
+			Version:    -1,
+			Migrations: nil,
+		},
+		{
+			Version:    2,
+			Migrations: []Migration{{Upgrade: upgrade}},
+		},
+		{
+			Version:    1,
+			Migrations: []Migration{{}},
+		},
+		{
+			Version:    1,
+			Migrations: []Migration{{Upgrade: upgrade}, {Upgrade: upgrade}},
+		},
+	}
+
+	for i, testCase := range testCases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("case", i+1, "expected", "panic", "got", nil)
+				}
+			}()
+
+			RegisterMigrations("github.com/the-anna-project/context/test/migration/invalid", testCase.Version, testCase.Migrations...)
+		}()
+	}
+}
@@ -0,0 +1,232 @@
+package context
+
+import (
+	"strings"
+	"time"
+)
+
+// separator joins the prefix of a namespace and the keys of its view. It must
+// not be "/", because then the keys of a package's namespace would collide with
+// the keys of its subpackages, e.g. the key behaviour of the namespace
+// .../current with the key of the package .../current/behaviour. The Go
+// toolchain rejects "#" in import paths, so no package path can contain it.
+const separator = "#"
+
+// Namespace returns a view of the given context whose keys are transparently
+// prefixed with the given prefix, which typically is a package path obtained
+// using gopkg.String. The key k of the view refers to the key prefix#k of the
+// given context. The empty key refers to the prefix itself, which is the key
+// packages of this repository store their information under. That way a
+// package owning a namespace cannot collide with or clobber the keys of other
+// packages, including the ones of its parent and child packages. The restore
+// information of a Key is stored under its own path .../restore and is thus not
+// part of the namespace. Keys, KeysWithPrefix, Len and Range of the view only
+// cover the namespace. Deadline, cancelation and JSON encoding are the ones of
+// the given context. Clone clones the given context and returns a view of the
+// clone. In case the given prefix is empty, the given context is returned.
+func Namespace(ctx Context, prefix string) Context {
+	return ctx.Namespace(prefix)
+}
+
+// DeleteNamespace removes all information of the given namespace from the given
+// context. See Namespace. In case the given context is read-only, an error is
+// returned which can be asserted using IsReadOnly.
+func DeleteNamespace(ctx Context, prefix string) error {
+	if IsFrozen(ctx) {
+		return maskAnyf(readOnlyError, "cannot delete namespace %s", prefix)
+	}
+
+	n := Namespace(ctx, prefix)
+	for _, k := range n.Keys() {
+		n.Delete(k)
+	}
+
+	return nil
+}
+
+func newNamespace(ctx Context, prefix string) Context {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return ctx
+	}
+
+	newContext := &namespace{
+		// Internals.
+		context: ctx,
+		prefix:  prefix,
+	}
+
+	return newContext
+}
+
+type namespace struct {
+	// Internals.
+	context Context
+	prefix  string
+}
+
+func (n *namespace) Cancel() {
+	n.context.Cancel()
+}
+
+func (n *namespace) Clone() (Context, error) {
+	newContext, err := n.context.Clone()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return newNamespace(newContext, n.prefix), nil
+}
+
+func (n *namespace) Create(key string, value interface{}) {
+	n.context.Create(n.key(key), value)
+}
+
+func (n *namespace) Deadline() (time.Time, bool) {
+	return n.context.Deadline()
+}
+
+func (n *namespace) Delete(key string) {
+	n.context.Delete(n.key(key))
+}
+
+func (n *namespace) Done() <-chan struct{} {
+	return n.context.Done()
+}
+
+func (n *namespace) Err() error {
+	return n.context.Err()
+}
+
+func (n *namespace) Keys() []string {
+	var keys []string
+	if n.contains(n.context.KeysWithPrefix(n.prefix)) {
+		keys = append(keys, "")
+	}
+	for _, k := range n.context.KeysWithPrefix(n.prefix + separator) {
+		keys = append(keys, strings.TrimPrefix(k, n.prefix+separator))
+	}
+
+	return keys
+}
+
+func (n *namespace) KeysWithPrefix(prefix string) []string {
+	var keys []string
+	for _, k := range n.Keys() {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+func (n *namespace) Len() int {
+	return len(n.Keys())
+}
+
+func (n *namespace) MarshalJSON() ([]byte, error) {
+	b, err := n.context.MarshalJSON()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return b, nil
+}
+
+func (n *namespace) Namespace(prefix string) Context {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return n
+	}
+
+	return newNamespace(n.context, n.key(prefix))
+}
+
+func (n *namespace) Range(f func(key string, value interface{}) bool) {
+	n.context.Range(func(key string, value interface{}) bool {
+		if key == n.prefix {
+			return f("", value)
+		}
+		if strings.HasPrefix(key, n.prefix+separator) {
+			return f(strings.TrimPrefix(key, n.prefix+separator), value)
+		}
+
+		return true
+	})
+}
+
+func (n *namespace) Search(key string) interface{} {
+	return n.context.Search(n.key(key))
+}
+
+func (n *namespace) UnmarshalJSON(b []byte) error {
+	err := n.context.UnmarshalJSON(b)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (n *namespace) Value(key interface{}) interface{} {
+	// String keys must never reach the underlying context unprefixed, because
+	// they would read information outside of the namespace.
+	if k, ok := key.(string); ok {
+		return n.context.Search(n.key(k))
+	}
+
+	return n.context.Value(key)
+}
+
+func (n *namespace) getLimits() Limits {
+	sc, err := statefulContext(n.context)
+	if err != nil {
+		return DefaultLimits()
+	}
+
+	return sc.getLimits()
+}
+
+func (n *namespace) getState() (state, error) {
+	sc, err := statefulContext(n.context)
+	if err != nil {
+		return state{}, maskAny(err)
+	}
+
+	s, err := sc.getState()
+	if err != nil {
+		return state{}, maskAny(err)
+	}
+
+	return s, nil
+}
+
+func (n *namespace) setState(s state) error {
+	sc, err := statefulContext(n.context)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	err = sc.setState(s)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// contains checks whether the given sorted keys contain the namespace's prefix
+// itself.
+func (n *namespace) contains(keys []string) bool {
+	return len(keys) != 0 && keys[0] == n.prefix
+}
+
+// key returns the key of the underlying context referred to by the given key.
+func (n *namespace) key(key string) string {
+	if key == "" {
+		return n.prefix
+	}
+
+	return n.prefix + separator + key
+}
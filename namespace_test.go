@@ -0,0 +1,147 @@
+package context
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_Namespace(t *testing.T) {
+	ctx := testNewContext(t)
+	ctx.Create("github.com/the-anna-project/context/current/behaviour", "one")
+	ctx.Create("github.com/the-anna-project/context/current/behaviourx", "other")
+
+	n := Namespace(ctx, "github.com/the-anna-project/context/current/behaviour/")
+	if n.Search("") != "one" {
+		t.Fatal("expected", "one", "got", n.Search(""))
+	}
+
+	n.Create("key", "val")
+	if ctx.Search("github.com/the-anna-project/context/current/behaviour#key") != "val" {
+		t.Fatal("expected", "val", "got", ctx.Search("github.com/the-anna-project/context/current/behaviour#key"))
+	}
+	if n.Search("key") != "val" {
+		t.Fatal("expected", "val", "got", n.Search("key"))
+	}
+	if n.Value("key") != "val" {
+		t.Fatal("expected", "val", "got", n.Value("key"))
+	}
+	if n.Search("foo") != nil {
+		t.Fatal("expected", nil, "got", n.Search("foo"))
+	}
+	// String keys never read information outside of the namespace.
+	if n.Value("foo") != nil {
+		t.Fatal("expected", nil, "got", n.Value("foo"))
+	}
+
+	// Listing only covers the namespace.
+	expected := []string{"", "key"}
+	if !reflect.DeepEqual(n.Keys(), expected) {
+		t.Fatal("expected", expected, "got", n.Keys())
+	}
+	if n.Len() != 2 {
+		t.Fatal("expected", 2, "got", n.Len())
+	}
+	if !reflect.DeepEqual(n.KeysWithPrefix("k"), []string{"key"}) {
+		t.Fatal("expected", []string{"key"}, "got", n.KeysWithPrefix("k"))
+	}
+	var keys []string
+	n.Range(func(key string, value interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatal("expected", expected, "got", keys)
+	}
+
+	// Namespaces can be nested.
+	sub := n.Namespace("sub")
+	sub.Create("key", "sub")
+	if n.Search("sub#key") != "sub" {
+		t.Fatal("expected", "sub", "got", n.Search("sub#key"))
+	}
+
+	// Clones are views as well.
+	clone, err := n.Clone()
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	clone.Delete("key")
+	if clone.Search("key") != nil {
+		t.Fatal("expected", nil, "got", clone.Search("key"))
+	}
+	if n.Search("key") != "val" {
+		t.Fatal("expected", "val", "got", n.Search("key"))
+	}
+
+	// An empty prefix does not create a view.
+	if Namespace(ctx, "") != ctx {
+		t.Fatal("expected", "same context", "got", "view")
+	}
+}
+
+func Test_DeleteNamespace(t *testing.T) {
+	ctx := testNewContext(t)
+	ctx.Create("github.com/the-anna-project/context/current/behaviour", "one")
+	ctx.Create("github.com/the-anna-project/context/current/behaviour#key", "two")
+	ctx.Create("github.com/the-anna-project/context/current/behaviour/restore", "three")
+	ctx.Create("github.com/the-anna-project/context/current/behaviourx", "other")
+
+	err := DeleteNamespace(Freeze(ctx), "github.com/the-anna-project/context/current/behaviour")
+	if !IsReadOnly(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+	err = DeleteNamespace(ctx, "github.com/the-anna-project/context/current/behaviour")
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	expected := []string{"foo", "github.com/the-anna-project/context/current/behaviour/restore", "github.com/the-anna-project/context/current/behaviourx", "other"}
+	if !reflect.DeepEqual(ctx.Keys(), expected) {
+		t.Fatal("expected", expected, "got", ctx.Keys())
+	}
+}
+
+func Test_Namespace_Nested(t *testing.T) {
+	ctx := testNewContext(t)
+	parent := Namespace(ctx, "github.com/the-anna-project/context/current")
+	child := Namespace(ctx, "github.com/the-anna-project/context/current/behaviour")
+
+	child.Create("", "child")
+	parent.Create("behaviour", "parent")
+	if child.Search("") != "child" {
+		t.Fatal("expected", "child", "got", child.Search(""))
+	}
+	if parent.Search("behaviour") != "parent" {
+		t.Fatal("expected", "parent", "got", parent.Search("behaviour"))
+	}
+	if !reflect.DeepEqual(parent.Keys(), []string{"behaviour"}) {
+		t.Fatal("expected", []string{"behaviour"}, "got", parent.Keys())
+	}
+	if !reflect.DeepEqual(child.Keys(), []string{""}) {
+		t.Fatal("expected", []string{""}, "got", child.Keys())
+	}
+
+	err := DeleteNamespace(ctx, "github.com/the-anna-project/context/current")
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if parent.Search("behaviour") != nil {
+		t.Fatal("expected", nil, "got", parent.Search("behaviour"))
+	}
+	if child.Search("") != "child" {
+		t.Fatal("expected", "child", "got", child.Search(""))
+	}
+}
+
+func Test_Namespace_Freeze(t *testing.T) {
+	ctx := testNewContext(t)
+	n := Freeze(ctx).Namespace("github.com/the-anna-project/context/test")
+	if !IsFrozen(n) {
+		t.Fatal("expected", true, "got", false)
+	}
+
+	err := Create(n, "key", "val")
+	if !IsReadOnly(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+}
@@ -0,0 +1,16 @@
+package context_test
+
+// The packages managing the context values of this repository are imported for
+// registering their keys, so that Test_Codec_Registered covers them.
+import (
+	_ "github.com/the-anna-project/context/current/behaviour"
+	_ "github.com/the-anna-project/context/current/clg/tree"
+	_ "github.com/the-anna-project/context/current/correlation"
+	_ "github.com/the-anna-project/context/current/destination"
+	_ "github.com/the-anna-project/context/current/expectation"
+	_ "github.com/the-anna-project/context/current/session"
+	_ "github.com/the-anna-project/context/current/source"
+	_ "github.com/the-anna-project/context/current/stage"
+	_ "github.com/the-anna-project/context/first/behaviour"
+	_ "github.com/the-anna-project/context/first/information"
+)
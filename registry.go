@@ -0,0 +1,159 @@
+package context
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// DecodeFunc restores a context value from its JSON representation.
+type DecodeFunc func(b []byte) (interface{}, error)
+
+var registry = struct {
+	sync.RWMutex
+	confidential map[string]bool
+	decoders     map[string]DecodeFunc
+	schemas      map[string]schema
+	types        map[string]reflect.Type
+}{
+	confidential: map[string]bool{},
+	decoders:     map[string]DecodeFunc{},
+	schemas:      map[string]schema{},
+	types:        map[string]reflect.Type{},
+}
+
+// Register associates the given key with the concrete type of the given value.
+// Values being unmarshalled using this key are restored using this type instead
+// of the generic types used by encoding/json. Packages managing context values
+// should register their keys on initialization. Register panics if value is nil
+// or if the key is registered twice.
+func Register(key string, value interface{}) {
+	if value == nil {
+		panic("context: Register value is nil")
+	}
+
+	t := reflect.TypeOf(value)
+
+	decode := func(b []byte) (interface{}, error) {
+		v := reflect.New(t)
+		err := json.Unmarshal(b, v.Interface())
+		if err != nil {
+			return nil, maskAny(err)
+		}
+
+		return v.Elem().Interface(), nil
+	}
+
+	err := register(decode, t, schema{}, key)
+	if err != nil {
+		panic("context: Register called twice for key " + key)
+	}
+}
+
+// RegisterFunc associates the given key with the given decode function. This
+// is useful for context values which cannot be described by a concrete type,
+// e.g. interfaces. RegisterFunc panics if decode is nil or if the key is
+// registered twice.
+func RegisterFunc(key string, decode DecodeFunc) {
+	if decode == nil {
+		panic("context: RegisterFunc decode is nil")
+	}
+
+	err := register(decode, nil, schema{}, key)
+	if err != nil {
+		panic("context: Register called twice for key " + key)
+	}
+}
+
+// RegisterConfidential marks the given keys as confidential. Context values of
+// confidential keys are encrypted using the keyring of the context whenever it
+// is encoded, so that they cannot be read by intermediate consumers of a queue.
+// Encoding a context storing confidential context values fails unless the
+// context has a keyring configured. Contexts decrypt such context values when
+// they are accessed using Search, Value or Range, given they have the required
+// key. Otherwise the context values remain encrypted and are not visible.
+// Decoding unencrypted context values of confidential keys fails, because they
+// cannot have been encoded by a context. See Config.Keyring.
+func RegisterConfidential(keys ...string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	for _, k := range keys {
+		registry.confidential[k] = true
+	}
+}
+
+// register associates all the given keys with the given decode function,
+// concrete type and schema. The concrete type is optional and only known in
+// case values are decoded using encoding/json directly. Codecs use it to
+// restore values without JSON. The schema is optional as well. In case any of
+// the keys is already registered, none of them is registered and an error is
+// returned.
+func register(decode DecodeFunc, t reflect.Type, s schema, keys ...string) error {
+	registry.Lock()
+	defer registry.Unlock()
+
+	for _, k := range keys {
+		if _, ok := registry.decoders[k]; ok && decode != nil {
+			return maskAnyf(alreadyRegisteredError, "key %s", k)
+		}
+		if _, ok := registry.schemas[k]; ok && !s.empty() {
+			return maskAnyf(alreadyRegisteredError, "migrations of key %s", k)
+		}
+	}
+	for _, k := range keys {
+		if decode != nil {
+			registry.decoders[k] = decode
+		}
+		if t != nil {
+			registry.types[k] = t
+		}
+		if !s.empty() {
+			registry.schemas[k] = s
+		}
+	}
+
+	return nil
+}
+
+// decodeValue restores the context value stored using the given key. Values of
+// unregistered keys are decoded using the generic types of encoding/json.
+func decodeValue(key string, b []byte) (interface{}, error) {
+	registry.RLock()
+	decode, ok := registry.decoders[key]
+	registry.RUnlock()
+
+	if ok {
+		v, err := decode(b)
+		if err != nil {
+			return nil, maskAnyf(invalidValueError, "key %s: %s", key, err.Error())
+		}
+
+		return v, nil
+	}
+
+	var v interface{}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return v, nil
+}
+
+// isConfidential checks whether the given key was registered as confidential.
+func isConfidential(key string) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	return registry.confidential[key]
+}
+
+// registration returns the decode function, concrete type and schema registered
+// for the given key. Each of them may be empty.
+func registration(key string) (DecodeFunc, reflect.Type, schema) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	return registry.decoders[key], registry.types[key], registry.schemas[key]
+}
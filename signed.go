@@ -0,0 +1,171 @@
+package context
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+)
+
+// SignedCodecConfig represents the configuration used to create a new signed
+// codec.
+type SignedCodecConfig struct {
+	// Settings.
+
+	// Codec encodes and decodes the contexts being signed. It defaults to the
+	// JSON codec. See NewJSONCodec.
+	Codec Codec
+	// KeyID identifies the key within Keys used to sign contexts.
+	KeyID string
+	// Keys maps key IDs to the secret keys used to sign and verify contexts.
+	// Keys can be rotated by first adding a new key to all processes, then
+	// signing using the new key and finally removing the old key.
+	Keys map[string][]byte
+}
+
+// DefaultSignedCodecConfig provides a default configuration to create a new
+// signed codec by best effort.
+func DefaultSignedCodecConfig() SignedCodecConfig {
+	newConfig := SignedCodecConfig{
+		// Settings.
+		Codec: NewJSONCodec(),
+		KeyID: "",
+		Keys:  nil,
+	}
+
+	return newConfig
+}
+
+// NewSignedCodec creates a codec attaching a HMAC-SHA256 signature to encoded
+// contexts. Decode rejects tampered payloads, payloads signed using unknown
+// keys and unsigned payloads with an error which can be asserted using
+// IsInvalidSignature. Nothing is merged into the decoding context unless the
+// signature is valid. Signatures prove that contexts were encoded by a process
+// knowing the key, they do not hide the information being transported.
+func NewSignedCodec(config SignedCodecConfig) (Codec, error) {
+	// Settings.
+	if config.Codec == nil {
+		return nil, maskAnyf(invalidConfigError, "codec must not be empty")
+	}
+	if len(config.Keys) == 0 {
+		return nil, maskAnyf(invalidConfigError, "keys must not be empty")
+	}
+	if _, ok := config.Keys[config.KeyID]; !ok {
+		return nil, maskAnyf(invalidConfigError, "key ID %q must be part of keys", config.KeyID)
+	}
+
+	keys := map[string][]byte{}
+	for id, key := range config.Keys {
+		if len(key) == 0 {
+			return nil, maskAnyf(invalidConfigError, "key %q must not be empty", id)
+		}
+		keys[id] = append([]byte(nil), key...)
+	}
+
+	newCodec := &signedCodec{
+		// Settings.
+		codec: config.Codec,
+		keyID: config.KeyID,
+		keys:  keys,
+	}
+
+	return newCodec, nil
+}
+
+// signedEnvelope is the representation of signed contexts. Payloads being JSON
+// are embedded as they are, all other payloads are embedded as binary.
+type signedEnvelope struct {
+	Binary    []byte          `json:"binary,omitempty"`
+	KeyID     string          `json:"key_id"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Signature []byte          `json:"signature"`
+}
+
+type signedCodec struct {
+	// Settings.
+	codec Codec
+	keyID string
+	keys  map[string][]byte
+}
+
+func (c *signedCodec) Decode(ctx Context, b []byte) error {
+	if sc, ok := ctx.(stateful); ok {
+		err := sc.getLimits().checkBytes(len(b))
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	var e signedEnvelope
+	err := json.Unmarshal(b, &e)
+	if err != nil {
+		return maskAnyf(invalidSignatureError, "payload is not signed")
+	}
+	if len(e.Signature) == 0 {
+		return maskAnyf(invalidSignatureError, "payload is not signed")
+	}
+	key, ok := c.keys[e.KeyID]
+	if !ok {
+		return maskAnyf(invalidSignatureError, "unknown key ID %q", e.KeyID)
+	}
+
+	payload := []byte(e.Payload)
+	if len(e.Binary) != 0 {
+		if len(payload) != 0 {
+			return maskAnyf(invalidSignatureError, "payload must either be JSON or binary")
+		}
+		payload = e.Binary
+	}
+	if !hmac.Equal(e.Signature, signPayload(key, payload)) {
+		return maskAnyf(invalidSignatureError, "signature does not match payload")
+	}
+
+	err = c.codec.Decode(ctx, payload)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (c *signedCodec) Encode(ctx Context) ([]byte, error) {
+	payload, err := c.codec.Encode(ctx)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	e := signedEnvelope{
+		KeyID: c.keyID,
+	}
+	if json.Valid(payload) {
+		// The payload is compacted and HTML escaped before signing, because
+		// encoding/json does the same with embedded JSON. Otherwise the
+		// envelope would carry other bytes than the signed ones, e.g. in case
+		// of the canonical codec, which does not escape HTML characters.
+		var buf bytes.Buffer
+		err := json.Compact(&buf, payload)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		var escaped bytes.Buffer
+		json.HTMLEscape(&escaped, buf.Bytes())
+		payload = escaped.Bytes()
+		e.Payload = payload
+	} else {
+		e.Binary = payload
+	}
+	e.Signature = signPayload(c.keys[c.keyID], payload)
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return b, nil
+}
+
+func signPayload(key, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,219 @@
+package context
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func testNewSignedCodec(t *testing.T, codec Codec, keyID string, keys map[string][]byte) Codec {
+	config := DefaultSignedCodecConfig()
+	if codec != nil {
+		config.Codec = codec
+	}
+	config.KeyID = keyID
+	config.Keys = keys
+	newCodec, err := NewSignedCodec(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return newCodec
+}
+
+func Test_SignedCodec(t *testing.T) {
+	keys := map[string][]byte{"one": []byte("secret-one")}
+
+	for _, codec := range []Codec{NewJSONCodec(), NewBinaryCodec(), NewCanonicalCodec()} {
+		signed := testNewSignedCodec(t, codec, "one", keys)
+
+		ctx := testNewContext(t)
+		ctx.Create("current/session", "session")
+		// HTML characters and line separators must not be escaped after signing.
+		ctx.Create("html", "a<b & c>d\u2028\u2029")
+		b, err := signed.Encode(ctx)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+
+		other, err := New(DefaultConfig())
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		err = signed.Decode(other, b)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		if other.Search("current/session") != "session" {
+			t.Fatal("expected", "session", "got", other.Search("current/session"))
+		}
+		if other.Search("html") != "a<b & c>d\u2028\u2029" {
+			t.Fatal("expected", "a<b & c>d\u2028\u2029", "got", other.Search("html"))
+		}
+		if other.Search("foo") != "bar" {
+			t.Fatal("expected", "bar", "got", other.Search("foo"))
+		}
+	}
+}
+
+func Test_SignedCodec_Rotation(t *testing.T) {
+	old := testNewSignedCodec(t, nil, "one", map[string][]byte{"one": []byte("secret-one")})
+	rotated := testNewSignedCodec(t, nil, "two", map[string][]byte{"one": []byte("secret-one"), "two": []byte("secret-two")})
+	removed := testNewSignedCodec(t, nil, "two", map[string][]byte{"two": []byte("secret-two")})
+
+	b, err := old.Encode(testNewContext(t))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	// Payloads signed using the old key are accepted as long as the key is known.
+	err = rotated.Decode(testNewContext(t), b)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = removed.Decode(testNewContext(t), b)
+	if !IsInvalidSignature(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+
+	// Payloads signed using the new key are rejected by processes not knowing it.
+	b, err = rotated.Encode(testNewContext(t))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = removed.Decode(testNewContext(t), b)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = old.Decode(testNewContext(t), b)
+	if !IsInvalidSignature(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+}
+
+func Test_SignedCodec_Invalid(t *testing.T) {
+	keys := map[string][]byte{"one": []byte("secret-one")}
+	signed := testNewSignedCodec(t, nil, "one", keys)
+	signedBinary := testNewSignedCodec(t, NewBinaryCodec(), "one", keys)
+
+	ctx := testNewContext(t)
+	ctx.Create("current/behaviour", "behaviour")
+	b, err := signed.Encode(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	binary, err := signedBinary.Encode(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	unsigned, err := ctx.MarshalJSON()
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	forged, err := testNewSignedCodec(t, nil, "one", map[string][]byte{"one": []byte("guessed")}).Encode(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	var e signedEnvelope
+	err = json.Unmarshal(binary, &e)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	e.Binary[len(e.Binary)-2] ^= 1
+	tamperedBinary, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	testCases := []struct {
+		Codec Codec
+		Bytes []byte
+	}{
+		// Case 1, a tampered context value.
+		{
+			Codec: signed,
+			Bytes: bytes.Replace(b, []byte(`"behaviour"`), []byte(`"malicious"`), 1),
+		},
+		// Case 2, a tampered binary payload.
+		{
+			Codec: signedBinary,
+			Bytes: tamperedBinary,
+		},
+		// Case 3, an unsigned context.
+		{
+			Codec: signed,
+			Bytes: unsigned,
+		},
+		// Case 4, a context signed using another key having the same ID.
+		{
+			Codec: signed,
+			Bytes: forged,
+		},
+		// Case 5, an unknown key ID.
+		{
+			Codec: signed,
+			Bytes: bytes.Replace(b, []byte(`"key_id":"one"`), []byte(`"key_id":"two"`), 1),
+		},
+		// Case 6, no JSON at all.
+		{
+			Codec: signed,
+			Bytes: []byte("actx"),
+		},
+	}
+
+	for i, testCase := range testCases {
+		other, err := New(DefaultConfig())
+		if err != nil {
+			t.Fatal("case", i+1, "expected", nil, "got", err)
+		}
+		err = testCase.Codec.Decode(other, testCase.Bytes)
+		if !IsInvalidSignature(err) {
+			t.Fatal("case", i+1, "expected", true, "got", false)
+		}
+		// Nothing is merged into contexts in case verification fails.
+		if other.Len() != 0 {
+			t.Fatal("case", i+1, "expected", 0, "got", other.Len())
+		}
+	}
+}
+
+func Test_NewSignedCodec_Invalid(t *testing.T) {
+	testCases := []struct {
+		Codec Codec
+		KeyID string
+		Keys  map[string][]byte
+	}{
+		{
+			Codec: nil,
+			KeyID: "one",
+			Keys:  map[string][]byte{"one": []byte("secret")},
+		},
+		{
+			Codec: NewJSONCodec(),
+			KeyID: "one",
+			Keys:  nil,
+		},
+		{
+			Codec: NewJSONCodec(),
+			KeyID: "two",
+			Keys:  map[string][]byte{"one": []byte("secret")},
+		},
+		{
+			Codec: NewJSONCodec(),
+			KeyID: "one",
+			Keys:  map[string][]byte{"one": nil},
+		},
+	}
+
+	for i, testCase := range testCases {
+		config := DefaultSignedCodecConfig()
+		config.Codec = testCase.Codec
+		config.KeyID = testCase.KeyID
+		config.Keys = testCase.Keys
+		_, err := NewSignedCodec(config)
+		if !IsInvalidConfig(err) {
+			t.Fatal("case", i+1, "expected", true, "got", false)
+		}
+	}
+}
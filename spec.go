@@ -1,18 +1,21 @@
 package context
 
 import (
+	nativecontext "context"
 	"encoding/json"
-	"time"
 )
 
 // Context is a marshallable container used to transport information across
-// processes. That is why the interface orients on the native golang context,
-// but does not fully replicate it. Reason for this is that a context maps keys
-// to values. JSON requires keys of maps to be strings. The native golang
-// context defines keys as interface{} to leverage go's type system for unique
-// keys. To prevent key collisions from interfering packages, each package
-// should prefix its key with its own package path like it would be imported.
-// This would be a good context package key, even though it is really long.
+// processes. That is why the interface extends the native golang context with
+// methods to manage and marshal information. A context maps keys to values.
+// JSON requires keys of maps to be strings. The native golang context defines
+// keys as interface{} to leverage go's type system for unique keys. That is why
+// information is managed using string keys via Create and Search. Value bridges
+// both worlds. String keys are looked up within the stored information first.
+// All other keys are looked up within the underlying native context. To
+// prevent key collisions from interfering packages, each package should prefix
+// its key with its own package path like it would be imported. This would be a
+// good context package key, even though it is really long.
 //
 //     github.com/the-anna-project/context/current/behaviour
 //
@@ -20,18 +23,52 @@ import (
 //
 //     github.com/the-anna-project/gopkg
 //
+// A context is safe for concurrent use by multiple goroutines.
 type Context interface {
+	nativecontext.Context
+
 	Cancel()
+	// Clone returns a copy of the current context. The information stored within
+	// the current context is deeply copied, so that modifications of the clone's
+	// information do not affect the current context and vice versa. See Cloner.
+	// The clone inherits deadline and cancelation of the current context.
+	// Canceling the current context cancels the clone, but canceling the clone
+	// does not affect the current context.
 	Clone() (Context, error)
 	// Create stores the given key/value pair within the current context. In case
 	// a key is provided that already exists, this key's value will be overwritten
-	// with the given one.
+	// with the given one. In case the current context is read-only, Create does
+	// nothing and the value cannot be read back. Callers which may receive
+	// read-only contexts must use the package level function Create instead,
+	// which returns an error that can be asserted using IsReadOnly. See Freeze.
 	Create(key string, value interface{})
-	Deadline() (time.Time, bool)
+	// Delete removes the given key from the current context. In case the current
+	// context is read-only, Delete does nothing. Callers which may receive
+	// read-only contexts must use the package level function Delete instead,
+	// which returns an error that can be asserted using IsReadOnly. See Freeze.
 	Delete(key string)
-	Done() <-chan struct{}
-	Err() error
 	json.Marshaler
 	json.Unmarshaler
+	// Keys returns the sorted list of keys of all information stored within the
+	// current context.
+	Keys() []string
+	// KeysWithPrefix returns the sorted list of keys having the given prefix.
+	// Prefixes are matched literally, so the prefix .../behaviour also matches
+	// the keys of a sibling package .../behaviourx. Callers listing the keys
+	// below a package path must add the trailing "/" themselves. Use the Keys
+	// of Namespace to list the information of a package without the one of
+	// sibling packages.
+	KeysWithPrefix(prefix string) []string
+	// Len returns the number of key/value pairs stored within the current
+	// context.
+	Len() int
+	// Namespace returns a view of the current context whose keys are
+	// transparently prefixed with the given prefix. See Namespace.
+	Namespace(prefix string) Context
+	// Range calls f for each key/value pair stored within the current context,
+	// in the order of Keys. Range stops as soon as f returns false. The pairs
+	// are gathered before f is called the first time, so f may modify the
+	// current context.
+	Range(f func(key string, value interface{}) bool)
 	Search(key string) interface{}
 }
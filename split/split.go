@@ -0,0 +1,85 @@
+// Package split provides splitting of a single context into a list of contexts
+// based on specific rules. It is the counterpart of
+// github.com/the-anna-project/context/merge.
+package split
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/the-anna-project/context"
+	currentbehaviour "github.com/the-anna-project/context/current/behaviour"
+	currentcorrelation "github.com/the-anna-project/context/current/correlation"
+	currentdestination "github.com/the-anna-project/context/current/destination"
+	currentsource "github.com/the-anna-project/context/current/source"
+)
+
+// NewContextsFromContext creates a new context for each of the given
+// destinations from the given context. Each created context is a clone of the
+// given context and carries the following information.
+//
+//     current/correlation, a new correlation ID shared by all created contexts
+//     current/destination, the destination the created context is sent to
+//     current/source, the current behaviour of the given context, if any
+//
+// In case the given context already carries a correlation, the new correlation
+// is nested within it. Merging the created contexts restores the correlation of
+// the given context, so that nested splits can be merged step by step.
+//
+// Canceling the given context cancels all created contexts. Each created
+// context can be canceled independently. The created contexts can be merged
+// again using github.com/the-anna-project/context/merge.
+func NewContextsFromContext(ctx context.Context, destinations []currentdestination.Value) ([]context.Context, error) {
+	if len(destinations) == 0 {
+		return nil, maskAnyf(invalidExecutionError, "destinations must not be empty")
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	correlation := currentcorrelation.Value{ID: id}
+	parent, ok := currentcorrelation.FromContext(ctx)
+	if ok {
+		correlation = parent.Child(id)
+	}
+
+	var source currentsource.Value
+	behaviour, ok := currentbehaviour.FromContext(ctx)
+	if ok {
+		source = currentsource.Value{
+			IDs:   []string{behaviour.ID},
+			Names: []string{behaviour.Name},
+		}
+	}
+
+	var ctxs []context.Context
+	for _, d := range destinations {
+		newCtx, err := ctx.Clone()
+		if err != nil {
+			return nil, maskAny(err)
+		}
+
+		newCtx = currentcorrelation.NewContext(newCtx, correlation)
+		newCtx = currentdestination.NewContext(newCtx, d)
+		if ok {
+			newCtx = currentsource.NewContext(newCtx, source)
+		}
+
+		ctxs = append(ctxs, newCtx)
+	}
+
+	return ctxs, nil
+}
+
+// newID returns a new random correlation ID.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", maskAny(err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,215 @@
+package split
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/the-anna-project/context"
+	currentbehaviour "github.com/the-anna-project/context/current/behaviour"
+	currentcorrelation "github.com/the-anna-project/context/current/correlation"
+	currentdestination "github.com/the-anna-project/context/current/destination"
+	currentsession "github.com/the-anna-project/context/current/session"
+	currentsource "github.com/the-anna-project/context/current/source"
+	"github.com/the-anna-project/context/merge"
+)
+
+func Test_NewContextsFromContext(t *testing.T) {
+	ctx := testNewContext(t)
+	ctx = currentbehaviour.NewContext(ctx, currentbehaviour.Value{ID: "id", Name: "name"})
+	ctx = currentsession.NewContext(ctx, currentsession.Value{ID: "session"})
+
+	destinations := testNewDestinations()
+	ctxs, err := NewContextsFromContext(ctx, destinations)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if len(ctxs) != len(destinations) {
+		t.Fatal("expected", len(destinations), "got", len(ctxs))
+	}
+
+	var id string
+	for i, c := range ctxs {
+		destination, ok := currentdestination.FromContext(c)
+		if !ok {
+			t.Fatal("case", i+1, "expected", true, "got", false)
+		}
+		if !destination.Equals(destinations[i]) {
+			t.Fatal("case", i+1, "expected", destinations[i], "got", destination)
+		}
+
+		correlation, ok := currentcorrelation.FromContext(c)
+		if !ok {
+			t.Fatal("case", i+1, "expected", true, "got", false)
+		}
+		if correlation.ID == "" {
+			t.Fatal("case", i+1, "expected", "id", "got", "")
+		}
+		if i != 0 && correlation.ID != id {
+			t.Fatal("case", i+1, "expected", id, "got", correlation.ID)
+		}
+		id = correlation.ID
+
+		source, ok := currentsource.FromContext(c)
+		if !ok {
+			t.Fatal("case", i+1, "expected", true, "got", false)
+		}
+		if !source.Equals(currentsource.Value{IDs: []string{"id"}, Names: []string{"name"}}) {
+			t.Fatal("case", i+1, "expected", "source", "got", source)
+		}
+
+		session, ok := currentsession.FromContext(c)
+		if !ok {
+			t.Fatal("case", i+1, "expected", true, "got", false)
+		}
+		if session.ID != "session" {
+			t.Fatal("case", i+1, "expected", "session", "got", session.ID)
+		}
+	}
+
+	// Another split uses another correlation ID.
+	other, err := NewContextsFromContext(ctx, destinations)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	correlation, _ := currentcorrelation.FromContext(other[0])
+	if correlation.ID == id {
+		t.Fatal("expected", "different id", "got", correlation.ID)
+	}
+}
+
+func Test_NewContextsFromContext_Empty(t *testing.T) {
+	_, err := NewContextsFromContext(testNewContext(t), nil)
+	if !IsInvalidExecution(err) {
+		t.Fatal("expected", true, "got", false)
+	}
+}
+
+func Test_NewContextsFromContext_Cancel(t *testing.T) {
+	ctx := testNewContext(t)
+	ctxs, err := NewContextsFromContext(ctx, testNewDestinations())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	// Canceling a single context does not cancel the others.
+	ctxs[0].Cancel()
+
+	select {
+	case <-time.After(5 * time.Millisecond):
+	case <-ctxs[1].Done():
+		t.Fatal("expected", "timeout", "got", "cancel")
+	}
+
+	// Canceling the given context cancels all created contexts.
+	ctx.Cancel()
+
+	for i, c := range ctxs {
+		select {
+		case <-time.After(5 * time.Millisecond):
+			t.Fatal("case", i+1, "expected", "cancel", "got", "timeout")
+		case <-c.Done():
+		}
+	}
+}
+
+func Test_NewContextsFromContext_Merge(t *testing.T) {
+	ctx := testNewContext(t)
+	ctx = currentbehaviour.NewContext(ctx, currentbehaviour.Value{ID: "id", Name: "name"})
+
+	ctxs, err := NewContextsFromContext(ctx, testNewDestinations())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	merged, err := merge.NewContextFromContexts(testNewContext(t), ctxs, merge.WithStrategy(currentdestination.Key.Name(), merge.LastWins))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	expected, _ := currentcorrelation.FromContext(ctxs[0])
+	correlation, ok := currentcorrelation.FromContext(merged)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if correlation.ID != expected.ID {
+		t.Fatal("expected", expected.ID, "got", correlation.ID)
+	}
+
+	source, _ := currentsource.FromContext(merged)
+	if !reflect.DeepEqual(source.IDs, []string{"id", "id", "id"}) {
+		t.Fatal("expected", []string{"id", "id", "id"}, "got", source.IDs)
+	}
+}
+
+func Test_NewContextsFromContext_Nested(t *testing.T) {
+	ctx := testNewContext(t)
+	ctx = currentbehaviour.NewContext(ctx, currentbehaviour.Value{ID: "id", Name: "name"})
+
+	outer, err := NewContextsFromContext(ctx, testNewDestinations()[:2])
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	expected, _ := currentcorrelation.FromContext(outer[0])
+
+	// Each context of the outer split is split again and merged afterwards.
+	var joined []context.Context
+	for i, c := range outer {
+		inner, err := NewContextsFromContext(c, testNewDestinations())
+		if err != nil {
+			t.Fatal("case", i+1, "expected", nil, "got", err)
+		}
+		correlation, _ := currentcorrelation.FromContext(inner[0])
+		if correlation.ID == expected.ID {
+			t.Fatal("case", i+1, "expected", "new correlation", "got", correlation.ID)
+		}
+		if !reflect.DeepEqual(correlation.Parents, []string{expected.ID}) {
+			t.Fatal("case", i+1, "expected", []string{expected.ID}, "got", correlation.Parents)
+		}
+
+		merged, err := merge.NewContextFromContexts(testNewContext(t), inner, merge.WithStrategy(currentdestination.Key.Name(), merge.LastWins))
+		if err != nil {
+			t.Fatal("case", i+1, "expected", nil, "got", err)
+		}
+		correlation, _ = currentcorrelation.FromContext(merged)
+		if !correlation.Equals(expected) {
+			t.Fatal("case", i+1, "expected", expected, "got", correlation)
+		}
+		joined = append(joined, merged)
+	}
+
+	// The outer merge succeeds, because the inner merges restored the outer
+	// correlation.
+	merged, err := merge.NewContextFromContexts(testNewContext(t), joined, merge.WithStrategy(currentdestination.Key.Name(), merge.LastWins))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	correlation, ok := currentcorrelation.FromContext(merged)
+	if !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+	if !correlation.Equals(expected) {
+		t.Fatal("expected", expected, "got", correlation)
+	}
+}
+
+func testNewContext(t *testing.T) context.Context {
+	var ctx context.Context
+	{
+		var err error
+		ctx, err = context.New(context.DefaultConfig())
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+	}
+
+	return ctx
+}
+
+func testNewDestinations() []currentdestination.Value {
+	return []currentdestination.Value{
+		{ID: "id1", Name: "name1"},
+		{ID: "id2", Name: "name2"},
+		{ID: "id3", Name: "name3"},
+	}
+}
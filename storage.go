@@ -0,0 +1,372 @@
+package context
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"sync"
+)
+
+// storage holds the information of a context. Implementations must be safe
+// for concurrent calls to Search, Range, Keys and Len. All other methods are
+// guarded by the write lock of the context owning the storage.
+type storage interface {
+	// Clone returns an independent copy of the current storage. See
+	// Context.Clone.
+	Clone() storage
+	Delete(key string)
+	// Keys returns the unsorted list of stored keys.
+	Keys() []string
+	Len() int
+	// Range calls f for each stored key/value pair. The values passed to f
+	// must not be modified.
+	Range(f func(key string, value interface{}))
+	Search(key string) (interface{}, bool)
+	Set(key string, value interface{})
+}
+
+// mapStorage stores information within a plain map, which is deeply copied on
+// each clone.
+type mapStorage map[string]interface{}
+
+func newMapStorage() mapStorage {
+	return mapStorage{}
+}
+
+func (s mapStorage) Clone() storage {
+	newStorage := make(mapStorage, len(s))
+	for k, v := range s {
+		newStorage[k] = cloneValue(v)
+	}
+
+	return newStorage
+}
+
+func (s mapStorage) Delete(key string) {
+	delete(s, key)
+}
+
+func (s mapStorage) Keys() []string {
+	var keys []string
+	for k := range s {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+func (s mapStorage) Len() int {
+	return len(s)
+}
+
+func (s mapStorage) Range(f func(key string, value interface{})) {
+	for k, v := range s {
+		f(k, v)
+	}
+}
+
+func (s mapStorage) Search(key string) (interface{}, bool) {
+	v, ok := s[key]
+	return v, ok
+}
+
+func (s mapStorage) Set(key string, value interface{}) {
+	s[key] = value
+}
+
+// cowStorage stores information within a persistent hash array mapped trie.
+// Cloning shares the trie between the current storage and the clone. Writes
+// only copy the path of the trie leading to the written entry. Each entry
+// remembers the storage it was written by. Entries written by another storage
+// are shared and deeply copied on first access, so that clones stay
+// independent. See Config.CopyOnWrite.
+type cowStorage struct {
+	mutex sync.Mutex
+	owner *cowOwner
+	root  *cowNode
+	size  int
+}
+
+// cowOwner identifies the storage an entry was written by. It must not be of
+// zero size, because pointers to distinct zero-size values may be equal.
+type cowOwner struct {
+	_ byte
+}
+
+// cowNode is a node of the trie. Each child is either a *cowNode or a
+// *cowLeaf. bitmap marks which of the 32 possible children are present.
+type cowNode struct {
+	bitmap   uint32
+	children []interface{}
+}
+
+// cowLeaf holds all entries sharing the same hash.
+type cowLeaf struct {
+	hash    uint64
+	entries []cowEntry
+}
+
+type cowEntry struct {
+	key   string
+	owner *cowOwner
+	value interface{}
+}
+
+const (
+	cowBits = 5
+	cowMask = 1<<cowBits - 1
+)
+
+func newCOWStorage() *cowStorage {
+	return &cowStorage{
+		owner: &cowOwner{},
+		root:  &cowNode{},
+		size:  0,
+	}
+}
+
+func (s *cowStorage) Clone() storage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// The current storage gets a new owner as well, so that neither the current
+	// storage nor the clone modify entries shared between them.
+	s.owner = &cowOwner{}
+
+	newStorage := &cowStorage{
+		owner: &cowOwner{},
+		root:  s.root,
+		size:  s.size,
+	}
+
+	return newStorage
+}
+
+func (s *cowStorage) Delete(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	root, ok := s.root.delete(cowHash(key), 0, key)
+	if !ok {
+		return
+	}
+	s.root = root
+	s.size--
+}
+
+func (s *cowStorage) Keys() []string {
+	var keys []string
+	s.Range(func(key string, value interface{}) {
+		keys = append(keys, key)
+	})
+
+	return keys
+}
+
+func (s *cowStorage) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.size
+}
+
+func (s *cowStorage) Range(f func(key string, value interface{})) {
+	s.mutex.Lock()
+	root := s.root
+	s.mutex.Unlock()
+
+	// The trie is immutable, so it can be walked without holding the lock.
+	root.walk(f)
+}
+
+func (s *cowStorage) Search(key string) (interface{}, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	h := cowHash(key)
+	e, ok := s.root.search(h, 0, key)
+	if !ok {
+		return nil, false
+	}
+	if e.owner == s.owner {
+		return e.value, true
+	}
+
+	// The entry is shared with other storages. It is copied before handing it
+	// out, so that modifications do not leak into other storages.
+	e.owner = s.owner
+	e.value = cloneValue(e.value)
+	s.root, _ = s.root.insert(h, 0, e)
+
+	return e.value, true
+}
+
+func (s *cowStorage) Set(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	root, added := s.root.insert(cowHash(key), 0, cowEntry{key: key, owner: s.owner, value: value})
+	s.root = root
+	if added {
+		s.size++
+	}
+}
+
+func cowHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// index returns the bit of the child responsible for the given hash at the
+// given shift, and the position of this child within the node's children.
+func (n *cowNode) index(h uint64, shift uint) (uint32, int) {
+	bit := uint32(1) << ((h >> shift) & cowMask)
+	return bit, bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+// delete returns a copy of the current node without the entry of the given key.
+// The returned bool is false in case there was no such entry. The returned node
+// is nil in case it does not have any children.
+func (n *cowNode) delete(h uint64, shift uint, key string) (*cowNode, bool) {
+	bit, pos := n.index(h, shift)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+
+	var child interface{}
+	switch c := n.children[pos].(type) {
+	case *cowNode:
+		newChild, ok := c.delete(h, shift+cowBits, key)
+		if !ok {
+			return n, false
+		}
+		if newChild != nil {
+			child = newChild
+		}
+	case *cowLeaf:
+		if c.hash != h {
+			return n, false
+		}
+		i := c.find(key)
+		if i < 0 {
+			return n, false
+		}
+		if len(c.entries) > 1 {
+			entries := make([]cowEntry, 0, len(c.entries)-1)
+			entries = append(entries, c.entries[:i]...)
+			entries = append(entries, c.entries[i+1:]...)
+			child = &cowLeaf{hash: h, entries: entries}
+		}
+	}
+
+	newNode := &cowNode{bitmap: n.bitmap}
+	if child != nil {
+		newNode.children = append([]interface{}(nil), n.children...)
+		newNode.children[pos] = child
+	} else {
+		newNode.bitmap &^= bit
+		if newNode.bitmap == 0 && shift != 0 {
+			return nil, true
+		}
+		newNode.children = make([]interface{}, 0, len(n.children)-1)
+		newNode.children = append(newNode.children, n.children[:pos]...)
+		newNode.children = append(newNode.children, n.children[pos+1:]...)
+	}
+
+	return newNode, true
+}
+
+// insert returns a copy of the current node containing the given entry. The
+// returned bool is true in case the entry's key was not yet present.
+func (n *cowNode) insert(h uint64, shift uint, e cowEntry) (*cowNode, bool) {
+	bit, pos := n.index(h, shift)
+
+	newNode := &cowNode{bitmap: n.bitmap | bit}
+
+	if n.bitmap&bit == 0 {
+		newNode.children = make([]interface{}, 0, len(n.children)+1)
+		newNode.children = append(newNode.children, n.children[:pos]...)
+		newNode.children = append(newNode.children, &cowLeaf{hash: h, entries: []cowEntry{e}})
+		newNode.children = append(newNode.children, n.children[pos:]...)
+		return newNode, true
+	}
+
+	var child interface{}
+	var added bool
+	switch c := n.children[pos].(type) {
+	case *cowNode:
+		child, added = c.insert(h, shift+cowBits, e)
+	case *cowLeaf:
+		if c.hash == h {
+			entries := append([]cowEntry(nil), c.entries...)
+			i := c.find(e.key)
+			if i < 0 {
+				entries = append(entries, e)
+				added = true
+			} else {
+				entries[i] = e
+			}
+			child = &cowLeaf{hash: h, entries: entries}
+		} else {
+			// Two different hashes share the same prefix. The leaf is pushed down
+			// into a new node, which is then able to tell both hashes apart.
+			sub := &cowNode{}
+			subBit, _ := sub.index(c.hash, shift+cowBits)
+			sub.bitmap = subBit
+			sub.children = []interface{}{c}
+			child, added = sub.insert(h, shift+cowBits, e)
+		}
+	}
+
+	newNode.children = append([]interface{}(nil), n.children...)
+	newNode.children[pos] = child
+
+	return newNode, added
+}
+
+func (n *cowNode) search(h uint64, shift uint, key string) (cowEntry, bool) {
+	for {
+		bit, pos := n.index(h, shift)
+		if n.bitmap&bit == 0 {
+			return cowEntry{}, false
+		}
+
+		switch c := n.children[pos].(type) {
+		case *cowNode:
+			n = c
+			shift += cowBits
+		case *cowLeaf:
+			if c.hash != h {
+				return cowEntry{}, false
+			}
+			i := c.find(key)
+			if i < 0 {
+				return cowEntry{}, false
+			}
+			return c.entries[i], true
+		}
+	}
+}
+
+func (n *cowNode) walk(f func(key string, value interface{})) {
+	for _, child := range n.children {
+		switch c := child.(type) {
+		case *cowNode:
+			c.walk(f)
+		case *cowLeaf:
+			for _, e := range c.entries {
+				f(e.key, e.value)
+			}
+		}
+	}
+}
+
+func (l *cowLeaf) find(key string) int {
+	for i, e := range l.entries {
+		if e.key == key {
+			return i
+		}
+	}
+
+	return -1
+}
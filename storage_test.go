@@ -0,0 +1,204 @@
+package context
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func Test_Storage(t *testing.T) {
+	testCases := []struct {
+		Name    string
+		Storage storage
+	}{
+		{
+			Name:    "map",
+			Storage: newMapStorage(),
+		},
+		{
+			Name:    "cow",
+			Storage: newCOWStorage(),
+		},
+	}
+
+	for _, testCase := range testCases {
+		s := testCase.Storage
+
+		var expected []string
+		for i := 0; i < 1000; i++ {
+			k := fmt.Sprintf("key-%d", i)
+			s.Set(k, i)
+			expected = append(expected, k)
+		}
+		s.Set("key-0", -1)
+
+		if s.Len() != 1000 {
+			t.Fatal("case", testCase.Name, "expected", 1000, "got", s.Len())
+		}
+		keys := s.Keys()
+		sort.Strings(keys)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(keys, expected) {
+			t.Fatal("case", testCase.Name, "expected", expected, "got", keys)
+		}
+		v, ok := s.Search("key-0")
+		if !ok {
+			t.Fatal("case", testCase.Name, "expected", true, "got", false)
+		}
+		if v != -1 {
+			t.Fatal("case", testCase.Name, "expected", -1, "got", v)
+		}
+		v, ok = s.Search("key-500")
+		if !ok {
+			t.Fatal("case", testCase.Name, "expected", true, "got", false)
+		}
+		if v != 500 {
+			t.Fatal("case", testCase.Name, "expected", 500, "got", v)
+		}
+
+		for i := 0; i < 1000; i += 2 {
+			s.Delete(fmt.Sprintf("key-%d", i))
+		}
+		s.Delete("missing")
+
+		if s.Len() != 500 {
+			t.Fatal("case", testCase.Name, "expected", 500, "got", s.Len())
+		}
+		_, ok = s.Search("key-500")
+		if ok {
+			t.Fatal("case", testCase.Name, "expected", false, "got", true)
+		}
+		_, ok = s.Search("key-501")
+		if !ok {
+			t.Fatal("case", testCase.Name, "expected", true, "got", false)
+		}
+
+		var n int
+		s.Range(func(key string, value interface{}) {
+			n++
+		})
+		if n != 500 {
+			t.Fatal("case", testCase.Name, "expected", 500, "got", n)
+		}
+	}
+}
+
+func Test_Storage_COW_Clone(t *testing.T) {
+	s1 := newCOWStorage()
+	s1.Set("foo", "bar")
+	s1.Set("ids", []string{"a", "b"})
+
+	s2 := s1.Clone()
+	s2.Set("foo", "baz")
+	s2.Set("other", 45)
+	s1.Delete("ids")
+
+	v, _ := s1.Search("foo")
+	if v != "bar" {
+		t.Fatal("expected", "bar", "got", v)
+	}
+	v, _ = s2.Search("foo")
+	if v != "baz" {
+		t.Fatal("expected", "baz", "got", v)
+	}
+	_, ok := s1.Search("other")
+	if ok {
+		t.Fatal("expected", false, "got", true)
+	}
+	if s1.Len() != 1 {
+		t.Fatal("expected", 1, "got", s1.Len())
+	}
+	if s2.Len() != 3 {
+		t.Fatal("expected", 3, "got", s2.Len())
+	}
+
+	// Shared values are copied on first access.
+	s3 := s2.Clone()
+	v, _ = s2.Search("ids")
+	v.([]string)[0] = "x"
+	v, _ = s3.Search("ids")
+	if v.([]string)[0] != "a" {
+		t.Fatal("expected", "a", "got", v.([]string)[0])
+	}
+
+	// Values being owned are not copied again.
+	v, _ = s2.Search("ids")
+	if v.([]string)[0] != "x" {
+		t.Fatal("expected", "x", "got", v.([]string)[0])
+	}
+}
+
+func Test_Clone_CopyOnWrite(t *testing.T) {
+	config := DefaultConfig()
+	config.CopyOnWrite = true
+	ctx1, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	ctx1.Create("foo", "bar")
+	ctx1.Create("ids", []string{"a", "b"})
+
+	ctx2, err := ctx1.Clone()
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if _, ok := ctx2.(*context).Storage.(*cowStorage); !ok {
+		t.Fatal("expected", true, "got", false)
+	}
+
+	ctx2.Create("foo", "baz")
+	ctx1.Search("ids").([]string)[0] = "x"
+
+	if ctx1.Search("foo") != "bar" {
+		t.Fatal("expected", "bar", "got", ctx1.Search("foo"))
+	}
+	if ctx2.Search("foo") != "baz" {
+		t.Fatal("expected", "baz", "got", ctx2.Search("foo"))
+	}
+	if ctx2.Search("ids").([]string)[0] != "a" {
+		t.Fatal("expected", "a", "got", ctx2.Search("ids").([]string)[0])
+	}
+
+	other := testJSONRoundTrip(t, ctx2)
+	if other.Search("foo") != "baz" {
+		t.Fatal("expected", "baz", "got", other.Search("foo"))
+	}
+}
+
+// Benchmark_Clone measures a single hop within a CLG network, which clones the
+// context and writes a single value to the clone.
+func Benchmark_Clone(b *testing.B) {
+	for _, copyOnWrite := range []bool{false, true} {
+		for _, size := range []int{10, 100, 1000} {
+			name := "map"
+			if copyOnWrite {
+				name = "cow"
+			}
+
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				config := DefaultConfig()
+				config.CopyOnWrite = copyOnWrite
+				ctx, err := New(config)
+				if err != nil {
+					b.Fatal("expected", nil, "got", err)
+				}
+				for i := 0; i < size; i++ {
+					ctx.Create(fmt.Sprintf("key-%d", i), testValue{IDs: []string{"a", "b"}, Name: "name"})
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					clone, err := ctx.Clone()
+					if err != nil {
+						b.Fatal("expected", nil, "got", err)
+					}
+					clone.Create("key-0", testValue{Name: "other"})
+					clone.Cancel()
+				}
+			})
+		}
+	}
+}